@@ -0,0 +1,414 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// brandingVolume mounts the branding assets into the public directory of the
+// Pangolin container so they can be served at /branding/<file>.
+const brandingVolume = "./config/branding:/app/public/branding:ro"
+
+// BrandingConfig mirrors the branding section of the Enterprise privateConfig.yml
+type BrandingConfig struct {
+	AppName              string                    `yaml:"app_name,omitempty"`
+	BackgroundImagePath  string                    `yaml:"background_image_path,omitempty"`
+	Colors               *BrandingColors           `yaml:"colors,omitempty"`
+	Logo                 *BrandingLogo             `yaml:"logo,omitempty"`
+	Footer               []BrandingFooterLink      `yaml:"footer,omitempty"`
+	HideAuthLayoutFooter bool                      `yaml:"hide_auth_layout_footer,omitempty"`
+	LoginPage            *BrandingPageText         `yaml:"login_page,omitempty"`
+	SignupPage           *BrandingPageText         `yaml:"signup_page,omitempty"`
+	ResourceAuthPage     *BrandingResourceAuthPage `yaml:"resource_auth_page,omitempty"`
+	Emails               *BrandingEmails           `yaml:"emails,omitempty"`
+}
+
+type BrandingColors struct {
+	Light map[string]string `yaml:"light,omitempty"`
+	Dark  map[string]string `yaml:"dark,omitempty"`
+}
+
+type BrandingLogo struct {
+	LightPath string            `yaml:"light_path,omitempty"`
+	DarkPath  string            `yaml:"dark_path,omitempty"`
+	AuthPage  *BrandingLogoSize `yaml:"auth_page,omitempty"`
+	Navbar    *BrandingLogoSize `yaml:"navbar,omitempty"`
+}
+
+type BrandingLogoSize struct {
+	Width  int `yaml:"width,omitempty"`
+	Height int `yaml:"height,omitempty"`
+}
+
+type BrandingFooterLink struct {
+	Text string `yaml:"text"`
+	Href string `yaml:"href,omitempty"`
+}
+
+type BrandingPageText struct {
+	SubtitleText string `yaml:"subtitle_text,omitempty"`
+}
+
+type BrandingResourceAuthPage struct {
+	ShowLogo      bool   `yaml:"show_logo,omitempty"`
+	HidePoweredBy bool   `yaml:"hide_powered_by,omitempty"`
+	TitleText     string `yaml:"title_text,omitempty"`
+	SubtitleText  string `yaml:"subtitle_text,omitempty"`
+}
+
+type BrandingEmails struct {
+	Signature string               `yaml:"signature,omitempty"`
+	Colors    *BrandingEmailColors `yaml:"colors,omitempty"`
+}
+
+type BrandingEmailColors struct {
+	Primary string `yaml:"primary,omitempty"`
+}
+
+// BrandingInput holds the answers of the branding wizard together with the
+// files that have to be copied into config/branding.
+type BrandingInput struct {
+	Branding BrandingConfig
+	// Assets maps a file name in config/branding to its source path
+	Assets map[string]string
+}
+
+// brandingColorKeys are the theme colors the wizard asks for. Any other key
+// supported by Pangolin can be added to privateConfig.yml by hand.
+var brandingColorKeys = []string{"primary", "primary-foreground", "background", "foreground"}
+
+var (
+	hexColorPattern  = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	funcColorPattern = regexp.MustCompile(`^(rgb|rgba|hsl|hsla|hwb|lab|lch|oklab|oklch)\(\s*[-+0-9.%a-z\s,/]+\)$`)
+)
+
+var brandingImageExtensions = []string{".png", ".jpg", ".jpeg", ".svg", ".webp", ".gif"}
+
+// validateColor accepts hex colors and the CSS color functions Pangolin's
+// stylesheets understand.
+func validateColor(color string) error {
+	color = strings.TrimSpace(color)
+	if hexColorPattern.MatchString(color) || funcColorPattern.MatchString(strings.ToLower(color)) {
+		return nil
+	}
+	return fmt.Errorf("invalid color %q: use a hex value like #F59E0B or a CSS color function like oklch(0.67 0.19 41.9)", color)
+}
+
+// readColor asks for a color. current is kept when the answer is empty.
+func readColor(prompt, current string) string {
+	for {
+		color := readOptionalString(prompt, current)
+		if color == "" || color == current {
+			return color
+		}
+		if err := validateColor(color); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		return strings.TrimSpace(color)
+	}
+}
+
+// readBrandingImage asks for an image on the host and registers it as an asset
+// named baseName. It returns the public path Pangolin serves the image from,
+// or current when the answer is empty.
+func readBrandingImage(prompt, baseName, current string, input *BrandingInput) string {
+	for {
+		source := readOptionalString(prompt, current)
+		if source == "" || source == current {
+			return source
+		}
+
+		if strings.HasPrefix(source, "~") {
+			if home, err := os.UserHomeDir(); err == nil {
+				source = filepath.Join(home, source[1:])
+			}
+		}
+
+		info, err := os.Stat(source)
+		if err != nil || info.IsDir() {
+			fmt.Printf("File %s does not exist or is not a regular file.\n", source)
+			continue
+		}
+
+		ext := strings.ToLower(filepath.Ext(source))
+		supported := false
+		for _, e := range brandingImageExtensions {
+			if ext == e {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			fmt.Printf("Unsupported image type %s. Supported types: %s\n", ext, strings.Join(brandingImageExtensions, ", "))
+			continue
+		}
+
+		name := baseName + ext
+		input.Assets[name] = source
+		return "/branding/" + name
+	}
+}
+
+func readLogoSize(label string, current *BrandingLogoSize) *BrandingLogoSize {
+	if !readBool(fmt.Sprintf("Do you want to set the logo size on the %s?", label), current != nil) {
+		return nil
+	}
+	size := BrandingLogoSize{Width: 100, Height: 100}
+	if current != nil {
+		size = *current
+	}
+	return &BrandingLogoSize{
+		Width:  readInt(fmt.Sprintf("Enter the logo width on the %s in pixels", label), size.Width),
+		Height: readInt(fmt.Sprintf("Enter the logo height on the %s in pixels", label), size.Height),
+	}
+}
+
+// collectBrandingInput runs the branding wizard. The answers default to the
+// current branding, so running it again only changes what the user changes.
+func collectBrandingInput(current BrandingConfig) *BrandingInput {
+	input := &BrandingInput{Assets: map[string]string{}}
+	b := &input.Branding
+
+	fmt.Println("\n=== Branding Configuration ===")
+	fmt.Println("Leave any value empty to keep the current value or the Pangolin default.")
+
+	b.AppName = readOptionalString("Enter the application name", current.AppName)
+
+	if readBool("Do you want to customize the theme colors?", current.Colors != nil) {
+		// Colors added to privateConfig.yml by hand are kept
+		colors := &BrandingColors{Light: map[string]string{}, Dark: map[string]string{}}
+		if current.Colors != nil {
+			maps.Copy(colors.Light, current.Colors.Light)
+			maps.Copy(colors.Dark, current.Colors.Dark)
+		}
+		for _, key := range brandingColorKeys {
+			if c := readColor(fmt.Sprintf("Enter the %s color for the light theme", key), colors.Light[key]); c != "" {
+				colors.Light[key] = c
+			}
+		}
+		for _, key := range brandingColorKeys {
+			if c := readColor(fmt.Sprintf("Enter the %s color for the dark theme", key), colors.Dark[key]); c != "" {
+				colors.Dark[key] = c
+			}
+		}
+		if len(colors.Light) > 0 || len(colors.Dark) > 0 {
+			b.Colors = colors
+		}
+	}
+
+	if readBool("Do you want to use a custom logo?", current.Logo != nil) {
+		currentLogo := BrandingLogo{}
+		if current.Logo != nil {
+			currentLogo = *current.Logo
+		}
+		logo := &BrandingLogo{
+			LightPath: readBrandingImage("Enter the path to the logo for the light theme", "logo-light", currentLogo.LightPath, input),
+			DarkPath:  readBrandingImage("Enter the path to the logo for the dark theme", "logo-dark", currentLogo.DarkPath, input),
+		}
+		logo.AuthPage = readLogoSize("authentication pages", currentLogo.AuthPage)
+		logo.Navbar = readLogoSize("navigation bar", currentLogo.Navbar)
+		if logo.LightPath != "" || logo.DarkPath != "" || logo.AuthPage != nil || logo.Navbar != nil {
+			b.Logo = logo
+		}
+	}
+
+	b.BackgroundImagePath = readBrandingImage("Enter the path to a background image for the authentication pages", "background", current.BackgroundImagePath, input)
+
+	if readBool("Do you want to customize the authentication page footer?", current.HideAuthLayoutFooter || len(current.Footer) > 0) {
+		b.HideAuthLayoutFooter = readBool("Hide the footer entirely?", current.HideAuthLayoutFooter)
+		if !b.HideAuthLayoutFooter {
+			if len(current.Footer) > 0 && readBool(fmt.Sprintf("Keep the %d current footer link(s)?", len(current.Footer)), true) {
+				b.Footer = slices.Clone(current.Footer)
+			}
+			for readBool("Add a footer link?", len(b.Footer) == 0) {
+				b.Footer = append(b.Footer, BrandingFooterLink{
+					Text: readString("Enter the footer text", ""),
+					Href: readOptionalString("Enter the footer link URL", ""),
+				})
+			}
+		}
+	}
+
+	currentLogin, currentSignup := BrandingPageText{}, BrandingPageText{}
+	if current.LoginPage != nil {
+		currentLogin = *current.LoginPage
+	}
+	if current.SignupPage != nil {
+		currentSignup = *current.SignupPage
+	}
+	if text := readOptionalString("Enter the login page subtitle", currentLogin.SubtitleText); text != "" {
+		b.LoginPage = &BrandingPageText{SubtitleText: text}
+	}
+	if text := readOptionalString("Enter the signup page subtitle", currentSignup.SubtitleText); text != "" {
+		b.SignupPage = &BrandingPageText{SubtitleText: text}
+	}
+
+	if readBool("Do you want to customize the resource authentication page?", current.ResourceAuthPage != nil) {
+		page := BrandingResourceAuthPage{ShowLogo: true}
+		if current.ResourceAuthPage != nil {
+			page = *current.ResourceAuthPage
+		}
+		b.ResourceAuthPage = &BrandingResourceAuthPage{
+			ShowLogo:      readBool("Show the logo on the resource authentication page?", page.ShowLogo),
+			HidePoweredBy: readBool("Hide the \"Powered by Pangolin\" notice?", page.HidePoweredBy),
+			TitleText:     readOptionalString("Enter the resource authentication page title", page.TitleText),
+			SubtitleText:  readOptionalString("Enter the resource authentication page subtitle", page.SubtitleText),
+		}
+	}
+
+	if readBool("Do you want to customize emails sent by Pangolin?", current.Emails != nil) {
+		currentEmails := BrandingEmails{}
+		if current.Emails != nil {
+			currentEmails = *current.Emails
+		}
+		currentPrimary := ""
+		if currentEmails.Colors != nil {
+			currentPrimary = currentEmails.Colors.Primary
+		}
+		emails := &BrandingEmails{
+			Signature: readOptionalString("Enter the email signature", currentEmails.Signature),
+		}
+		if c := readColor("Enter the primary color used in emails", currentPrimary); c != "" {
+			emails.Colors = &BrandingEmailColors{Primary: c}
+		}
+		if emails.Signature != "" || emails.Colors != nil {
+			b.Emails = emails
+		}
+	}
+
+	return input
+}
+
+// readBrandingConfig returns the branding section of privateConfig.yml. A
+// missing file or section is an empty branding.
+func readBrandingConfig(path string) (BrandingConfig, error) {
+	var branding BrandingConfig
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return branding, nil
+	} else if err != nil {
+		return branding, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	var config struct {
+		Branding BrandingConfig `yaml:"branding"`
+	}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return branding, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return config.Branding, nil
+}
+
+// writeBrandingConfig writes the branding section of privateConfig.yml key by
+// key. Keys the wizard does not know about are left alone.
+func writeBrandingConfig(path string, branding BrandingConfig) error {
+	var encoded yaml.Node
+	if err := encoded.Encode(branding); err != nil {
+		return fmt.Errorf("error encoding branding: %w", err)
+	}
+	values := map[string]*yaml.Node{}
+	for i := 0; i+1 < len(encoded.Content); i += 2 {
+		values[encoded.Content[i].Value] = encoded.Content[i+1]
+	}
+
+	return updateYAMLFile(path, func(doc *yaml.Node) error {
+		if section := lookupYAMLNode(doc, "branding"); section != nil && section.Kind != yaml.MappingNode {
+			deleteYAMLValue(doc, "branding")
+		}
+
+		brandingType := reflect.TypeOf(branding)
+		for i := 0; i < brandingType.NumField(); i++ {
+			key, _, _ := strings.Cut(brandingType.Field(i).Tag.Get("yaml"), ",")
+			value, ok := values[key]
+			if !ok {
+				deleteYAMLValue(doc, "branding", key)
+				continue
+			}
+			if err := setYAMLValue(doc, value, "branding", key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// applyBranding copies the branding assets into config/branding, writes the
+// branding section of config/privateConfig.yml and makes sure the assets are
+// mounted into the Pangolin container.
+func applyBranding(input *BrandingInput) error {
+	if len(input.Assets) > 0 {
+		if err := os.MkdirAll("config/branding", 0755); err != nil {
+			return fmt.Errorf("failed to create branding directory: %v", err)
+		}
+	}
+
+	for name, source := range input.Assets {
+		if err := copyFile(source, filepath.Join("config/branding", name)); err != nil {
+			return fmt.Errorf("failed to copy %s: %v", source, err)
+		}
+	}
+
+	if err := writeBrandingConfig("config/privateConfig.yml", input.Branding); err != nil {
+		return fmt.Errorf("failed to write branding configuration: %v", err)
+	}
+
+	if len(input.Assets) > 0 {
+		if err := checkAndAddServiceVolume("docker-compose.yml", "pangolin", brandingVolume); err != nil {
+			return fmt.Errorf("failed to mount branding directory: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// isEnterpriseInstall reports whether the compose file runs the Enterprise
+// Pangolin image.
+func isEnterpriseInstall() bool {
+	return checkIfTextInFile("docker-compose.yml", "fosrl/pangolin:ee-")
+}
+
+func runBrandingCommand(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("branding does not take any arguments")
+	}
+
+	if _, err := enterInstallDirectory(); err != nil {
+		return err
+	}
+
+	if !isEnterpriseInstall() {
+		return fmt.Errorf("branding is only available in the Enterprise version of Pangolin")
+	}
+
+	current, err := readBrandingConfig("config/privateConfig.yml")
+	if err != nil {
+		return err
+	}
+
+	if err := applyBranding(collectBrandingInput(current)); err != nil {
+		return err
+	}
+
+	fmt.Println("\nBranding updated successfully!")
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		fmt.Println("Restart the pangolin container to apply the new branding.")
+		return nil
+	}
+
+	if readBool("Would you like to restart Pangolin to apply the new branding?", true) {
+		return restartContainer("pangolin", containerType)
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteBrandingConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		installed string
+		branding  BrandingConfig
+		want      string
+	}{
+		{
+			name:     "new file",
+			branding: BrandingConfig{AppName: "Acme"},
+			want:     "branding:\n  app_name: Acme\n",
+		},
+		{
+			name:      "other sections are kept",
+			installed: "flags:\n  enable_redis: true\n",
+			branding:  BrandingConfig{AppName: "Acme"},
+			want:      "flags:\n  enable_redis: true\nbranding:\n  app_name: Acme\n",
+		},
+		{
+			name:      "changed keys are replaced",
+			installed: "branding:\n  app_name: Old\n  colors:\n    light:\n      primary: '#000000'\n",
+			branding: BrandingConfig{
+				AppName: "Acme",
+				Colors:  &BrandingColors{Light: map[string]string{"primary": "#F59E0B"}},
+			},
+			want: "branding:\n  app_name: Acme\n  colors:\n    light:\n      primary: '#F59E0B'\n",
+		},
+		{
+			name:      "cleared keys are removed",
+			installed: "branding:\n  app_name: Acme\n  hide_auth_layout_footer: true\n  footer:\n    - text: Imprint\n",
+			branding:  BrandingConfig{AppName: "Acme"},
+			want:      "branding:\n  app_name: Acme\n",
+		},
+		{
+			name:      "unknown keys are kept",
+			installed: "branding:\n  app_name: Old\n  favicon_path: /branding/favicon.ico\n",
+			branding:  BrandingConfig{AppName: "Acme"},
+			want:      "branding:\n  app_name: Acme\n  favicon_path: /branding/favicon.ico\n",
+		},
+		{
+			name:      "empty section",
+			installed: "branding:\n",
+			branding:  BrandingConfig{AppName: "Acme"},
+			want:      "branding:\n  app_name: Acme\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "privateConfig.yml")
+			if tt.installed != "" {
+				if err := os.WriteFile(path, []byte(tt.installed), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := writeBrandingConfig(path, tt.branding); err != nil {
+				t.Fatalf("writeBrandingConfig() error = %v", err)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decodeYAML(t, got), decodeYAML(t, []byte(tt.want))) {
+				t.Errorf("writeBrandingConfig() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadBrandingConfig(t *testing.T) {
+	dir := t.TempDir()
+	branding, err := readBrandingConfig(filepath.Join(dir, "missing.yml"))
+	if err != nil || !reflect.DeepEqual(branding, BrandingConfig{}) {
+		t.Fatalf("readBrandingConfig() of a missing file = %+v, %v", branding, err)
+	}
+
+	want := BrandingConfig{
+		AppName: "Acme",
+		Logo: &BrandingLogo{
+			LightPath: "/branding/logo-light.png",
+			Navbar:    &BrandingLogoSize{Width: 120, Height: 40},
+		},
+		Footer:           []BrandingFooterLink{{Text: "Imprint", Href: "https://example.com/imprint"}},
+		ResourceAuthPage: &BrandingResourceAuthPage{ShowLogo: true, TitleText: "Sign in"},
+	}
+	path := filepath.Join(dir, "privateConfig.yml")
+	if err := writeBrandingConfig(path, want); err != nil {
+		t.Fatal(err)
+	}
+
+	branding, err = readBrandingConfig(path)
+	if err != nil {
+		t.Fatalf("readBrandingConfig() error = %v", err)
+	}
+	if !reflect.DeepEqual(branding, want) {
+		t.Errorf("readBrandingConfig() = %+v, want %+v", branding, want)
+	}
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	bundleManifestFile = "bundle.json"
+	bundleGeoLite2File = "GeoLite2-Country.tar.gz"
+	// localPluginsDir holds the plugin sources Traefik loads from /plugins-local
+	// in an air-gapped installation.
+	localPluginsDir = "config/traefik/plugins-local"
+	geoLite2URL     = "https://github.com/GitSquared/node-geolite2-redist/raw/refs/heads/master/redist/GeoLite2-Country.tar.gz"
+)
+
+// bundleFlag points at an air-gapped bundle to install from.
+var bundleFlag string
+
+// activeBundle is the bundle opened from --bundle. When it is set the
+// installer must not access the network.
+var activeBundle *offlineBundle
+
+// bundleManifest describes the contents of an air-gapped bundle.
+type bundleManifest struct {
+	PangolinVersion string          `json:"pangolin_version"`
+	GerbilVersion   string          `json:"gerbil_version"`
+	BadgerVersion   string          `json:"badger_version"`
+	Enterprise      bool            `json:"enterprise"`
+	Images          []bundleImage   `json:"images"`
+	Plugins         []traefikPlugin `json:"plugins"`
+	GeoLite2        string          `json:"geolite2"`
+}
+
+type bundleImage struct {
+	Image string `json:"image"`
+	File  string `json:"file"`
+}
+
+// traefikPlugin is an entry of experimental.plugins in the Traefik static
+// configuration.
+type traefikPlugin struct {
+	Name       string `json:"name" yaml:"-"`
+	ModuleName string `json:"module_name" yaml:"moduleName"`
+	Version    string `json:"version" yaml:"version"`
+}
+
+// offlineBundle is an extracted bundle on the target machine.
+type offlineBundle struct {
+	dir      string
+	manifest bundleManifest
+	// extracted is set when dir is a temporary extraction of an archive
+	extracted bool
+}
+
+// bundleConfig returns the configuration used to render the compose files and
+// Traefik configuration whose images and plugins go into a bundle. Everything
+// optional is enabled so the bundle covers any answer given on the target.
+func bundleConfig(enterprise bool) Config {
+	var config Config
+	loadVersions(&config)
+	config.IsEnterprise = enterprise
+	config.InstallGerbil = true
+	config.InstallRedis = enterprise
+	config.EnableRedis = enterprise
+	config.HTTPPort = 80
+	config.HTTPSPort = 443
+	config.DashboardDomain = "pangolin.example.com"
+	config.Domains = []DomainConfig{{Key: "domain1", BaseDomain: "example.com"}}
+	return config
+}
+
+// readComposeImages returns the images referenced by a compose file.
+func readComposeImages(content []byte) ([]string, error) {
+	var compose struct {
+		Services map[string]struct {
+			Image string `yaml:"image"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(content, &compose); err != nil {
+		return nil, fmt.Errorf("error parsing compose file: %w", err)
+	}
+
+	var images []string
+	for _, service := range compose.Services {
+		if service.Image != "" {
+			images = append(images, service.Image)
+		}
+	}
+	return images, nil
+}
+
+// readTraefikPlugins returns the plugins declared in experimental.plugins of a
+// Traefik static configuration.
+func readTraefikPlugins(content []byte) ([]traefikPlugin, error) {
+	var traefikConfig struct {
+		Experimental struct {
+			Plugins map[string]traefikPlugin `yaml:"plugins"`
+		} `yaml:"experimental"`
+	}
+	if err := yaml.Unmarshal(content, &traefikConfig); err != nil {
+		return nil, fmt.Errorf("error parsing traefik config: %w", err)
+	}
+
+	var plugins []traefikPlugin
+	for name, plugin := range traefikConfig.Experimental.Plugins {
+		plugin.Name = name
+		plugins = append(plugins, plugin)
+	}
+	return plugins, nil
+}
+
+// bundleContents renders the compose file and Traefik configuration of the
+// installer and returns the images and plugins they use. CrowdSec is left out,
+// it downloads its hub collections at startup.
+func bundleContents(config Config) ([]string, []traefikPlugin, error) {
+	seenImages := map[string]bool{}
+	seenPlugins := map[string]bool{}
+	var images []string
+	var plugins []traefikPlugin
+
+	for _, path := range []string{"config/docker-compose.yml"} {
+		content, err := renderEmbeddedConfig(path, config)
+		if err != nil {
+			return nil, nil, err
+		}
+		found, err := readComposeImages([]byte(content))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for _, image := range found {
+			if !seenImages[image] {
+				seenImages[image] = true
+				images = append(images, image)
+			}
+		}
+	}
+
+	for _, path := range []string{"config/traefik/traefik_config.yml"} {
+		content, err := renderEmbeddedConfig(path, config)
+		if err != nil {
+			return nil, nil, err
+		}
+		found, err := readTraefikPlugins([]byte(content))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for _, plugin := range found {
+			if !seenPlugins[plugin.ModuleName] {
+				seenPlugins[plugin.ModuleName] = true
+				plugins = append(plugins, plugin)
+			}
+		}
+	}
+
+	sort.Strings(images)
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return images, plugins, nil
+}
+
+// imageArchiveName turns an image reference into a file name.
+func imageArchiveName(image string) string {
+	replacer := strings.NewReplacer("/", "_", ":", "_", "@", "_")
+	return replacer.Replace(image) + ".tar"
+}
+
+// createBundle downloads everything an installation needs into a tar.gz
+// archive at output: the container images, the GeoLite2 database and the
+// sources of the Traefik plugins.
+func createBundle(containerType SupportedContainer, enterprise bool, output string) error {
+	config := bundleConfig(enterprise)
+	if config.PangolinVersion == "" || config.GerbilVersion == "" || config.BadgerVersion == "" {
+		return fmt.Errorf("this installer build does not contain the Pangolin, Gerbil and Badger versions")
+	}
+
+	images, plugins, err := bundleContents(config)
+	if err != nil {
+		return err
+	}
+	if enterprise {
+		// Keep the Community Edition image so both editions can be installed
+		community, _, err := bundleContents(bundleConfig(false))
+		if err != nil {
+			return err
+		}
+		for _, image := range community {
+			if !slices.Contains(images, image) {
+				images = append(images, image)
+			}
+		}
+	}
+
+	rt, err := containerRuntime(containerType)
+	if err != nil {
+		return err
+	}
+	if err := rt.Login(); err != nil {
+		return err
+	}
+
+	workDir, err := os.MkdirTemp("", "pangolin-bundle-")
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	manifest := bundleManifest{
+		PangolinVersion: config.PangolinVersion,
+		GerbilVersion:   config.GerbilVersion,
+		BadgerVersion:   config.BadgerVersion,
+		Enterprise:      enterprise,
+		Plugins:         plugins,
+		GeoLite2:        bundleGeoLite2File,
+	}
+
+	if err := os.MkdirAll(filepath.Join(workDir, "images"), 0755); err != nil {
+		return fmt.Errorf("failed to create the images directory: %v", err)
+	}
+	for _, image := range images {
+		fmt.Printf("Saving %s...\n", image)
+		if err := rt.PullImage(image); err != nil {
+			return fmt.Errorf("failed to pull %s: %v", image, err)
+		}
+
+		file := filepath.Join("images", imageArchiveName(image))
+		if err := rt.SaveImage(image, filepath.Join(workDir, file)); err != nil {
+			return fmt.Errorf("failed to save %s: %v", image, err)
+		}
+		manifest.Images = append(manifest.Images, bundleImage{Image: image, File: file})
+	}
+
+	fmt.Println("Downloading the MaxMind GeoLite2 Country database...")
+	if err := run("curl", "-fL", "-o", filepath.Join(workDir, bundleGeoLite2File), geoLite2URL); err != nil {
+		return fmt.Errorf("failed to download the GeoLite2 database: %v", err)
+	}
+
+	for _, plugin := range plugins {
+		fmt.Printf("Downloading the %s Traefik plugin %s...\n", plugin.Name, plugin.Version)
+		if !strings.HasPrefix(plugin.ModuleName, "github.com/") {
+			return fmt.Errorf("cannot download plugin %s: only GitHub modules are supported", plugin.ModuleName)
+		}
+
+		src := filepath.Join(workDir, "plugins", "src", plugin.ModuleName)
+		if err := os.MkdirAll(src, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %v", src, err)
+		}
+		archive := filepath.Join(workDir, "plugin.tar.gz")
+		url := fmt.Sprintf("https://%s/archive/refs/tags/%s.tar.gz", plugin.ModuleName, plugin.Version)
+		if err := run("curl", "-fL", "-o", archive, url); err != nil {
+			return fmt.Errorf("failed to download plugin %s: %v", plugin.ModuleName, err)
+		}
+		if err := run("tar", "-xzf", archive, "-C", src, "--strip-components=1"); err != nil {
+			return fmt.Errorf("failed to extract plugin %s: %v", plugin.ModuleName, err)
+		}
+		if err := os.Remove(archive); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", archive, err)
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the bundle manifest: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, bundleManifestFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write the bundle manifest: %v", err)
+	}
+
+	absOutput, err := filepath.Abs(output)
+	if err != nil {
+		return fmt.Errorf("invalid output path %s: %v", output, err)
+	}
+	if err := run("tar", "-czf", absOutput, "-C", workDir, "."); err != nil {
+		return fmt.Errorf("failed to write %s: %v", output, err)
+	}
+
+	fmt.Printf("Bundle written to %s\n", output)
+	fmt.Printf("Copy it and this installer to the target machine and run: installer --bundle %s\n", filepath.Base(output))
+	return nil
+}
+
+// openBundle opens a bundle directory or extracts a bundle archive.
+func openBundle(path string) (*offlineBundle, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle path: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open bundle: %v", err)
+	}
+
+	b := &offlineBundle{dir: path}
+	if !info.IsDir() {
+		if b.dir, err = os.MkdirTemp("", "pangolin-bundle-"); err != nil {
+			return nil, fmt.Errorf("failed to create a temporary directory: %v", err)
+		}
+		b.extracted = true
+		fmt.Println("Extracting the bundle...")
+		if err := run("tar", "-xzf", path, "-C", b.dir); err != nil {
+			b.Close()
+			return nil, fmt.Errorf("failed to extract the bundle: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(b.dir, bundleManifestFile))
+	if err != nil {
+		b.Close()
+		return nil, fmt.Errorf("%s is not a Pangolin bundle: %v", path, err)
+	}
+
+	if err := json.Unmarshal(data, &b.manifest); err != nil {
+		b.Close()
+		return nil, fmt.Errorf("invalid bundle manifest: %v", err)
+	}
+	return b, nil
+}
+
+// Close removes the extracted archive. A bundle directory is left alone.
+func (b *offlineBundle) Close() {
+	if !b.extracted {
+		return
+	}
+	if err := os.RemoveAll(b.dir); err != nil {
+		fmt.Printf("Warning: could not remove %s: %v\n", b.dir, err)
+	}
+}
+
+// applyVersions makes the rendered configuration match the saved images.
+func (b *offlineBundle) applyVersions(config *Config) {
+	config.PangolinVersion = b.manifest.PangolinVersion
+	config.GerbilVersion = b.manifest.GerbilVersion
+	config.BadgerVersion = b.manifest.BadgerVersion
+
+	if config.IsEnterprise && !b.manifest.Enterprise {
+		fmt.Println("Error: the bundle does not contain the Enterprise image. Create it with `bundle create --enterprise`.")
+		os.Exit(1)
+	}
+}
+
+// loadImages loads the saved images into the container engine.
+func (b *offlineBundle) loadImages(containerType SupportedContainer) error {
+	rt, err := containerRuntime(containerType)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Loading the container images from the bundle...")
+	for _, image := range b.manifest.Images {
+		if err := rt.LoadImage(filepath.Join(b.dir, image.File)); err != nil {
+			return fmt.Errorf("failed to load %s: %v", image.Image, err)
+		}
+	}
+	return nil
+}
+
+// installGeoLite2 extracts the GeoLite2 database of the bundle into config/.
+func (b *offlineBundle) installGeoLite2() error {
+	tmp, err := os.MkdirTemp("", "geolite2-")
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := run("tar", "-xzf", filepath.Join(b.dir, b.manifest.GeoLite2), "-C", tmp); err != nil {
+		return fmt.Errorf("failed to extract GeoLite2 database: %v", err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(tmp, "GeoLite2-Country_*", "GeoLite2-Country.mmdb"))
+	if err != nil || len(matches) == 0 {
+		return fmt.Errorf("the bundle does not contain GeoLite2-Country.mmdb")
+	}
+	if err := copyFile(matches[0], "config/GeoLite2-Country.mmdb"); err != nil {
+		return fmt.Errorf("failed to install GeoLite2 database: %v", err)
+	}
+
+	fmt.Println("MaxMind GeoLite2 Country database installed from the bundle!")
+	return nil
+}
+
+// installLocalPlugins copies the plugin sources into the installation, mounts
+// them into Traefik and switches the Traefik configuration to load them
+// locally instead of downloading them at startup.
+func (b *offlineBundle) installLocalPlugins() error {
+	src := filepath.Join(localPluginsDir, "src")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", src, err)
+	}
+	if err := run("cp", "-R", filepath.Join(b.dir, "plugins", "src")+"/.", src); err != nil {
+		return fmt.Errorf("failed to copy the Traefik plugins: %v", err)
+	}
+
+	if err := checkAndAddServiceVolume("docker-compose.yml", "traefik", "./"+localPluginsDir+":/plugins-local:ro"); err != nil {
+		return err
+	}
+
+	return useLocalPlugins("config/traefik/traefik_config.yml")
+}
+
+// useLocalPlugins moves every entry of experimental.plugins to
+// experimental.localPlugins, which Traefik loads from /plugins-local/src.
+func useLocalPlugins(traefikConfigPath string) error {
+	return updateYAMLFile(traefikConfigPath, func(doc *yaml.Node) error {
+		plugins := lookupYAMLNode(doc, "experimental", "plugins")
+		if plugins == nil || plugins.Kind != yaml.MappingNode {
+			return errYAMLUnchanged
+		}
+
+		for i := 0; i+1 < len(plugins.Content); i += 2 {
+			moduleName := lookupYAMLNode(plugins.Content[i+1], "moduleName")
+			if moduleName == nil {
+				return fmt.Errorf("plugin %s has no moduleName", plugins.Content[i].Value)
+			}
+			local := map[string]string{"moduleName": moduleName.Value}
+			if err := setYAMLValue(doc, local, "experimental", "localPlugins", plugins.Content[i].Value); err != nil {
+				return err
+			}
+		}
+
+		deleteYAMLValue(doc, "experimental", "plugins")
+		return nil
+	})
+}
+
+func runBundleCommand(args []string) error {
+	if len(args) == 0 || args[0] != "create" {
+		return fmt.Errorf("usage: bundle create [--enterprise] [output.tar.gz]")
+	}
+
+	enterprise := false
+	output := ""
+	for _, arg := range args[1:] {
+		if arg == "--enterprise" {
+			enterprise = true
+			continue
+		}
+		output = arg
+	}
+	if output == "" {
+		output = fmt.Sprintf("pangolin-bundle-%s.tar.gz", pangolinVersion)
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		return fmt.Errorf("no running container engine found to pull the images with, pass --runtime")
+	}
+
+	if err := loadRegistrySettings(); err != nil {
+		return err
+	}
+
+	return createBundle(containerType, enterprise, output)
+}
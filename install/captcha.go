@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// captchaVolume mounts the captcha page at the path the CrowdSec plugin reads
+// it from.
+const captchaVolume = "./config/crowdsec/captcha.html:/captcha.html:ro"
+
+// captchaProviders are the providers supported by the CrowdSec Traefik plugin
+// with the page to create keys at.
+var captchaProviders = map[string]string{
+	"turnstile": "https://dash.cloudflare.com/?to=/:account/turnstile",
+	"hcaptcha":  "https://dashboard.hcaptcha.com/sites",
+	"recaptcha": "https://www.google.com/recaptcha/admin",
+}
+
+// collectCaptchaInput asks for the captcha provider CrowdSec captcha
+// decisions are answered with. Without one, CrowdSec only issues bans.
+func collectCaptchaInput(config *Config) {
+	fmt.Println("CrowdSec can show suspicious HTTP clients a captcha instead of banning them. This needs a Turnstile, hCaptcha or reCAPTCHA site.")
+
+	for {
+		provider := strings.ToLower(strings.TrimSpace(readString("Which captcha provider do you want to use? (turnstile, hcaptcha, recaptcha or none)", "none")))
+		if provider == "none" {
+			config.CaptchaProvider = ""
+			fmt.Println("No captcha provider: CrowdSec will ban suspicious clients instead.")
+			return
+		}
+
+		keysURL, ok := captchaProviders[provider]
+		if !ok {
+			fmt.Printf("Error: unknown captcha provider %q\n", provider)
+			continue
+		}
+
+		fmt.Printf("Create a site and its keys at %s\n", keysURL)
+		config.CaptchaProvider = provider
+		config.CaptchaSiteKey = readString("Enter the captcha site key", "")
+		config.CaptchaSecretKey = readPassword("Enter the captcha secret key")
+		fmt.Println("The captcha page can be customized in config/crowdsec/captcha.html.")
+		return
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// installerCommand is a subcommand that manages an existing installation. It is
+// invoked as `installer <name> [args...]`; running the installer without a
+// subcommand starts the interactive installation.
+type installerCommand struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var installerCommands = []installerCommand{
+	{
+		name:        "branding",
+		description: "Update the Enterprise branding of an existing installation",
+		run:         runBrandingCommand,
+	},
+	{
+		name:        "bundle",
+		description: "Create an air-gapped installation bundle (bundle create [--enterprise] [output.tar.gz])",
+		run:         runBundleCommand,
+	},
+	{
+		name:        "crowdsec",
+		description: "Manage the CrowdSec integration (crowdsec help for the subcommands)",
+		run:         runCrowdsecCommand,
+	},
+	{
+		name:        "domains",
+		description: "List, add or remove base domains (domains list|add|remove <domain>)",
+		run:         runDomainsCommand,
+	},
+	{
+		name:        "service",
+		description: "Manage the pangolin.service systemd unit (service install|uninstall|status)",
+		run:         runServiceCommand,
+	},
+	{
+		name:        "status",
+		description: "Show the state of the containers and of pangolin.service",
+		run:         runStatusCommand,
+	},
+	{
+		name:        "verify",
+		description: "Report drift between images.lock and the running containers (verify [--update])",
+		run:         runVerifyCommand,
+	},
+}
+
+func runInstallerCommand(args []string) {
+	name := args[0]
+
+	if name == "help" || name == "-h" || name == "--help" {
+		printInstallerUsage()
+		return
+	}
+
+	for _, cmd := range installerCommands {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(args[1:]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Printf("Unknown command: %s\n\n", name)
+	printInstallerUsage()
+	os.Exit(1)
+}
+
+func printInstallerUsage() {
+	fmt.Println("Usage: installer [options] [command] [arguments]")
+	fmt.Println("")
+	fmt.Println("Run without a command to install or update Pangolin interactively.")
+	fmt.Println("")
+	fmt.Println("Commands:")
+	for _, cmd := range installerCommands {
+		fmt.Printf("  %-12s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Println("")
+	fmt.Println("Options:")
+	flag.VisitAll(func(f *flag.Flag) {
+		fmt.Printf("  --%-20s %s\n", f.Name, f.Usage)
+	})
+}
+
+// enterInstallDirectory changes into an existing installation, looking in the
+// current directory first and the default location second.
+func enterInstallDirectory() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("error getting current directory: %v", err)
+	}
+
+	installDir := cwd
+	if !hasExistingInstall(installDir) {
+		if !hasExistingInstall(defaultInstallDir) {
+			return "", fmt.Errorf("no Pangolin installation found in %s or %s", cwd, defaultInstallDir)
+		}
+		installDir = defaultInstallDir
+	}
+
+	if err := os.Chdir(installDir); err != nil {
+		return "", fmt.Errorf("error changing to installation directory: %v", err)
+	}
+
+	return installDir, nil
+}
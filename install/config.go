@@ -2,9 +2,11 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"reflect"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -50,11 +52,23 @@ type AppConfig struct {
 		DashboardURL string `yaml:"dashboard_url"`
 		LogLevel     string `yaml:"log_level"`
 	} `yaml:"app"`
+	Email struct {
+		SMTPHost string `yaml:"smtp_host"`
+		SMTPPort int    `yaml:"smtp_port"`
+		SMTPUser string `yaml:"smtp_user"`
+		SMTPPass string `yaml:"smtp_pass"`
+		NoReply  string `yaml:"no_reply"`
+	} `yaml:"email"`
 }
 
 type AppConfigValues struct {
-	DashboardURL string
-	LogLevel     string
+	DashboardURL  string
+	LogLevel      string
+	EmailSMTPHost string
+	EmailSMTPPort int
+	EmailSMTPUser string
+	EmailSMTPPass string
+	EmailNoReply  string
 }
 
 // ReadTraefikConfig reads and extracts values from Traefik configuration files
@@ -92,8 +106,13 @@ func ReadAppConfig(configPath string) (*AppConfigValues, error) {
 	}
 
 	values := &AppConfigValues{
-		DashboardURL: appConfig.App.DashboardURL,
-		LogLevel:     appConfig.App.LogLevel,
+		DashboardURL:  appConfig.App.DashboardURL,
+		LogLevel:      appConfig.App.LogLevel,
+		EmailSMTPHost: appConfig.Email.SMTPHost,
+		EmailSMTPPort: appConfig.Email.SMTPPort,
+		EmailSMTPUser: appConfig.Email.SMTPUser,
+		EmailSMTPPass: appConfig.Email.SMTPPass,
+		EmailNoReply:  appConfig.Email.NoReply,
 	}
 
 	return values, nil
@@ -144,6 +163,13 @@ func copyDockerService(sourceFile, destFile, serviceName string) error {
 		destCompose["services"] = destServices
 	}
 
+	// Pull the service from the configured registry
+	if service, ok := serviceConfig.(map[string]any); ok {
+		if image, ok := service["image"].(string); ok {
+			service["image"] = rewriteImageReference(image)
+		}
+	}
+
 	// Update service in destination
 	destServices[serviceName] = serviceConfig
 
@@ -245,7 +271,7 @@ func CheckAndAddTraefikLogVolume(composePath string) error {
 	}
 
 	// Check volumes
-	logVolume := "./config/traefik/logs:/var/log/traefik"
+	logVolume := traefikLogVolume
 	var volumes []any
 
 	if existingVolumes, ok := traefik["volumes"].([]any); ok {
@@ -348,3 +374,295 @@ func mergeMap(base, overlay map[string]any) map[string]any {
 
 	return result
 }
+
+// errYAMLUnchanged can be returned from an updateYAMLFile callback to leave the
+// file untouched.
+var errYAMLUnchanged = errors.New("yaml unchanged")
+
+// updateYAMLFile parses the YAML file at path into a node tree, lets fn modify
+// it and writes the result back. Working on nodes instead of maps keeps the
+// comments and key order of the file intact. A missing file is treated as an
+// empty document.
+func updateYAMLFile(path string, fn func(doc *yaml.Node) error) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+
+	if err := fn(&doc); err != nil {
+		if errors.Is(err, errYAMLUnchanged) {
+			return nil
+		}
+		return err
+	}
+
+	updated, err := MarshalYAMLWithIndent(&doc, detectYAMLIndent(content))
+	if err != nil {
+		return fmt.Errorf("error marshaling %s: %w", path, err)
+	}
+
+	if err := os.WriteFile(path, updated, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// detectYAMLIndent returns the indentation width used by a YAML document so it
+// can be written back in the same style. It defaults to two spaces.
+func detectYAMLIndent(content []byte) int {
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed == line || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "- ") {
+			continue
+		}
+		return len(line) - len(trimmed)
+	}
+	return 2
+}
+
+// lookupYAMLNode returns the node found by following keys through nested
+// mappings, or nil if any key along the way does not exist.
+func lookupYAMLNode(doc *yaml.Node, keys ...string) *yaml.Node {
+	node := doc
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return nil
+		}
+		node = node.Content[0]
+	}
+
+	for _, key := range keys {
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+
+	return node
+}
+
+// setYAMLValue encodes value and stores it under keys, creating intermediate
+// mappings as needed. An existing value at that path is replaced.
+func setYAMLValue(doc *yaml.Node, value any, keys ...string) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("no YAML path given")
+	}
+
+	var valueNode yaml.Node
+	if err := valueNode.Encode(value); err != nil {
+		return fmt.Errorf("error encoding value for %s: %w", strings.Join(keys, "."), err)
+	}
+
+	node := doc
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+		}
+		node = node.Content[0]
+	}
+
+	for depth, key := range keys {
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s is not a mapping", strings.Join(keys[:depth], "."))
+		}
+
+		last := depth == len(keys)-1
+		found := false
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value != key {
+				continue
+			}
+			if last {
+				node.Content[i+1] = &valueNode
+			} else {
+				node = node.Content[i+1]
+			}
+			found = true
+			break
+		}
+		if found {
+			continue
+		}
+
+		keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+		if last {
+			node.Content = append(node.Content, keyNode, &valueNode)
+		} else {
+			child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node.Content = append(node.Content, keyNode, child)
+			node = child
+		}
+	}
+
+	return nil
+}
+
+// deleteYAMLValue removes the key at the end of keys. It reports whether a
+// value was removed.
+func deleteYAMLValue(doc *yaml.Node, keys ...string) bool {
+	if len(keys) == 0 {
+		return false
+	}
+
+	parent := lookupYAMLNode(doc, keys[:len(keys)-1]...)
+	if parent == nil || parent.Kind != yaml.MappingNode {
+		return false
+	}
+
+	key := keys[len(keys)-1]
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == key {
+			parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// UnmergeYAML reverses MergeYAML. base and overlay are the documents that were
+// merged; every key the overlay added is removed from the file, values the
+// overlay changed are reset to the base value if they were not edited since,
+// and sequence items only the overlay contains are dropped. Keys the overlay
+// does not know about are left alone.
+func UnmergeYAML(path string, base, overlay []byte) error {
+	var baseMap, overlayMap map[string]any
+	if err := yaml.Unmarshal(base, &baseMap); err != nil {
+		return fmt.Errorf("error parsing base YAML: %v", err)
+	}
+	if err := yaml.Unmarshal(overlay, &overlayMap); err != nil {
+		return fmt.Errorf("error parsing overlay YAML: %v", err)
+	}
+
+	return updateYAMLFile(path, func(doc *yaml.Node) error {
+		if len(doc.Content) == 0 {
+			return errYAMLUnchanged
+		}
+		return unmergeYAMLNode(doc.Content[0], baseMap, overlayMap)
+	})
+}
+
+func unmergeYAMLNode(node *yaml.Node, base, overlay map[string]any) error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for key, overlayValue := range overlay {
+		index := -1
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			continue
+		}
+		value := node.Content[index+1]
+		baseValue, inBase := base[key]
+
+		switch overlayValue := overlayValue.(type) {
+		case map[string]any:
+			baseMap, _ := baseValue.(map[string]any)
+			if err := unmergeYAMLNode(value, baseMap, overlayValue); err != nil {
+				return err
+			}
+			if !inBase && value.Kind == yaml.MappingNode && len(value.Content) == 0 {
+				node.Content = append(node.Content[:index], node.Content[index+2:]...)
+			}
+		case []any:
+			if value.Kind != yaml.SequenceNode {
+				continue
+			}
+			baseItems, _ := baseValue.([]any)
+			for i := 0; i < len(value.Content); {
+				var item any
+				if err := value.Content[i].Decode(&item); err != nil {
+					return err
+				}
+				if containsYAMLValue(overlayValue, item) && !containsYAMLValue(baseItems, item) {
+					value.Content = append(value.Content[:i], value.Content[i+1:]...)
+					continue
+				}
+				i++
+			}
+			if !inBase && len(value.Content) == 0 {
+				node.Content = append(node.Content[:index], node.Content[index+2:]...)
+			}
+		default:
+			if !inBase {
+				node.Content = append(node.Content[:index], node.Content[index+2:]...)
+				continue
+			}
+			var current any
+			if err := value.Decode(&current); err != nil {
+				return err
+			}
+			if reflect.DeepEqual(current, overlayValue) && !reflect.DeepEqual(current, baseValue) {
+				var baseNode yaml.Node
+				if err := baseNode.Encode(baseValue); err != nil {
+					return err
+				}
+				node.Content[index+1] = &baseNode
+			}
+		}
+	}
+
+	return nil
+}
+
+func containsYAMLValue(items []any, value any) bool {
+	for _, item := range items {
+		if reflect.DeepEqual(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAndAddServiceVolume adds a volume to a service in the compose file if it
+// is not already mounted.
+func checkAndAddServiceVolume(composePath, serviceName, volume string) error {
+	return updateYAMLFile(composePath, func(doc *yaml.Node) error {
+		service := lookupYAMLNode(doc, "services", serviceName)
+		if service == nil {
+			return fmt.Errorf("%s service not found in %s", serviceName, composePath)
+		}
+
+		volumes := lookupYAMLNode(service, "volumes")
+		if volumes == nil {
+			return setYAMLValue(service, []string{volume}, "volumes")
+		}
+		if volumes.Kind != yaml.SequenceNode {
+			return fmt.Errorf("volumes of the %s service have an invalid format", serviceName)
+		}
+
+		for _, v := range volumes.Content {
+			if v.Value == volume {
+				return errYAMLUnchanged
+			}
+		}
+
+		volumes.Content = append(volumes.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: volume})
+		return nil
+	})
+}
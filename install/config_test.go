@@ -0,0 +1,280 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeYAML decodes content for comparisons that ignore formatting.
+func decodeYAML(t *testing.T, content []byte) any {
+	t.Helper()
+	var value any
+	if err := yaml.Unmarshal(content, &value); err != nil {
+		t.Fatalf("invalid YAML: %v\n%s", err, content)
+	}
+	return value
+}
+
+func TestUnmergeYAML(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      string
+		overlay   string
+		installed string
+		want      string
+	}{
+		{
+			name:      "added keys are removed",
+			base:      "a:\n  b: 1\n",
+			overlay:   "a:\n  c: 2\nd: 3\n",
+			installed: "a:\n  b: 1\n  c: 2\nd: 3\n",
+			want:      "a:\n  b: 1\n",
+		},
+		{
+			name:      "added keys are removed even when edited",
+			base:      "a: 1\n",
+			overlay:   "b: 2\n",
+			installed: "a: 1\nb: 5\n",
+			want:      "a: 1\n",
+		},
+		{
+			name:      "added mapping is removed when empty",
+			base:      "a: 1\n",
+			overlay:   "m:\n  x: 1\n  y: 2\n",
+			installed: "a: 1\nm:\n  x: 1\n  y: 2\n",
+			want:      "a: 1\n",
+		},
+		{
+			name:      "added mapping keeps user keys",
+			base:      "a: 1\n",
+			overlay:   "m:\n  x: 1\n",
+			installed: "a: 1\nm:\n  x: 1\n  user: true\n",
+			want:      "a: 1\nm:\n  user: true\n",
+		},
+		{
+			name:      "user keys next to added keys are kept",
+			base:      "a:\n  b: 1\n",
+			overlay:   "a:\n  c: 2\n",
+			installed: "a:\n  b: 1\n  c: 2\n  user: x\ntop: y\n",
+			want:      "a:\n  b: 1\n  user: x\ntop: y\n",
+		},
+		{
+			name:      "changed scalar is reverted",
+			base:      "log:\n  format: common\n",
+			overlay:   "log:\n  format: json\n",
+			installed: "log:\n  format: json\n",
+			want:      "log:\n  format: common\n",
+		},
+		{
+			name:      "changed scalar edited by the user is kept",
+			base:      "log:\n  format: common\n",
+			overlay:   "log:\n  format: json\n",
+			installed: "log:\n  format: logfmt\n",
+			want:      "log:\n  format: logfmt\n",
+		},
+		{
+			name:      "scalar the overlay repeats is kept",
+			base:      "level: INFO\n",
+			overlay:   "level: INFO\n",
+			installed: "level: DEBUG\n",
+			want:      "level: DEBUG\n",
+		},
+		{
+			name:      "added sequence items are removed",
+			base:      "l:\n  - a\n",
+			overlay:   "l:\n  - b\n",
+			installed: "l:\n  - a\n  - b\n",
+			want:      "l:\n  - a\n",
+		},
+		{
+			name:      "user sequence items are kept",
+			base:      "l:\n  - a\n",
+			overlay:   "l:\n  - b\n",
+			installed: "l:\n  - a\n  - user\n  - b\n",
+			want:      "l:\n  - a\n  - user\n",
+		},
+		{
+			name:      "base sequence items the overlay repeats are kept",
+			base:      "l:\n  - a\n",
+			overlay:   "l:\n  - a\n  - b\n",
+			installed: "l:\n  - a\n  - b\n",
+			want:      "l:\n  - a\n",
+		},
+		{
+			name:      "added sequence is removed when empty",
+			base:      "a: 1\n",
+			overlay:   "l:\n  - x\n",
+			installed: "a: 1\nl:\n  - x\n",
+			want:      "a: 1\n",
+		},
+		{
+			name:      "added sequence keeps user items",
+			base:      "a: 1\n",
+			overlay:   "l:\n  - x\n",
+			installed: "a: 1\nl:\n  - x\n  - user\n",
+			want:      "a: 1\nl:\n  - user\n",
+		},
+		{
+			name:      "keys missing from the file are ignored",
+			base:      "a: 1\n",
+			overlay:   "b: 2\nm:\n  c: 3\n",
+			installed: "a: 1\n",
+			want:      "a: 1\n",
+		},
+		{
+			name:      "type changed by the user is left alone",
+			base:      "a: 1\n",
+			overlay:   "l:\n  - x\n",
+			installed: "a: 1\nl: user\n",
+			want:      "a: 1\nl: user\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yml")
+			if err := os.WriteFile(path, []byte(tt.installed), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := UnmergeYAML(path, []byte(tt.base), []byte(tt.overlay)); err != nil {
+				t.Fatalf("UnmergeYAML() error = %v", err)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decodeYAML(t, got), decodeYAML(t, []byte(tt.want))) {
+				t.Errorf("UnmergeYAML() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmergeYAMLKeepsComments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	installed := "# user comment\na: 1 # keep\nb: 2\n"
+	if err := os.WriteFile(path, []byte(installed), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UnmergeYAML(path, []byte("a: 1\n"), []byte("b: 2\n")); err != nil {
+		t.Fatalf("UnmergeYAML() error = %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# user comment\na: 1 # keep\n"; string(got) != want {
+		t.Errorf("UnmergeYAML() = %q, want %q", got, want)
+	}
+}
+
+// TestUnmergeEmbeddedConfig installs the CrowdSec overlays the way
+// installCrowdsec does, edits the result like a user would and checks that
+// removing CrowdSec restores the base configuration with the user edits.
+func TestUnmergeEmbeddedConfig(t *testing.T) {
+	config := Config{
+		DashboardDomain:         "pangolin.example.com",
+		LetsEncryptEmail:        "admin@example.com",
+		BadgerVersion:           "v1.2.0",
+		TraefikBouncerKey:       "key",
+		CaptchaProvider:         "turnstile",
+		CrowdsecAppsec:          true,
+		CrowdsecAppsecBodyLimit: 10 * 1024 * 1024,
+		TrustedProxyIPs:         []string{"203.0.113.0/24"},
+	}
+
+	tests := []struct {
+		file    string
+		overlay string
+		// edit changes the installed file after CrowdSec was added
+		edit func(doc *yaml.Node) error
+		// cleanup is what removeCrowdsec does besides the unmerge
+		cleanup []string
+	}{
+		{
+			file:    "config/traefik/traefik_config.yml",
+			overlay: "config/crowdsec/traefik_config.yml",
+			edit: func(doc *yaml.Node) error {
+				return setYAMLValue(doc, "DEBUG", "log", "level")
+			},
+		},
+		{
+			file:    "config/traefik/dynamic_config.yml",
+			overlay: "config/crowdsec/dynamic_config.yml",
+			edit: func(doc *yaml.Node) error {
+				return setYAMLValue(doc, map[string]any{"redirectScheme": map[string]any{"scheme": "https"}}, "http", "middlewares", "user-redirect")
+			},
+			cleanup: crowdsecPluginPath[:3],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(filepath.Base(tt.file), func(t *testing.T) {
+			dir := t.TempDir()
+			base, err := renderEmbeddedConfig(tt.file, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			overlay, err := renderEmbeddedConfig(tt.overlay, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			installed := filepath.Join(dir, "installed.yml")
+			overlayPath := filepath.Join(dir, "overlay.yml")
+			if err := os.WriteFile(installed, []byte(base), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(overlayPath, []byte(overlay), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := MergeYAML(installed, overlayPath); err != nil {
+				t.Fatal(err)
+			}
+			if err := updateYAMLFile(installed, tt.edit); err != nil {
+				t.Fatal(err)
+			}
+
+			want := filepath.Join(dir, "want.yml")
+			if err := os.WriteFile(want, []byte(base), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := updateYAMLFile(want, tt.edit); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := unmergeEmbeddedConfig(installed, tt.file, tt.overlay); err != nil {
+				t.Fatalf("unmergeEmbeddedConfig() error = %v", err)
+			}
+
+			if tt.cleanup != nil {
+				if err := updateYAMLFile(installed, func(doc *yaml.Node) error {
+					deleteYAMLValue(doc, tt.cleanup...)
+					return nil
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := os.ReadFile(installed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantContent, err := os.ReadFile(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decodeYAML(t, got), decodeYAML(t, wantContent)) {
+				t.Errorf("after removing CrowdSec:\n%s\nwant\n%s", got, wantContent)
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
@@ -9,37 +8,9 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
-	"time"
+	"sync"
 )
 
-func waitForContainer(containerName string, containerType SupportedContainer) error {
-	maxAttempts := 30
-	retryInterval := time.Second * 2
-
-	for attempt := 0; attempt < maxAttempts; attempt++ {
-		// Check if container is running
-		cmd := exec.Command(string(containerType), "container", "inspect", "-f", "{{.State.Running}}", containerName)
-		var out bytes.Buffer
-		cmd.Stdout = &out
-
-		if err := cmd.Run(); err != nil {
-			// If the container doesn't exist or there's another error, wait and retry
-			time.Sleep(retryInterval)
-			continue
-		}
-
-		isRunning := strings.TrimSpace(out.String()) == "true"
-		if isRunning {
-			return nil
-		}
-
-		// Container exists but isn't running yet, wait and retry
-		time.Sleep(retryInterval)
-	}
-
-	return fmt.Errorf("container %s did not start within %v seconds", containerName, maxAttempts*int(retryInterval.Seconds()))
-}
-
 func installDocker() error {
 	// Detect Linux distribution
 	cmd := exec.Command("cat", "/etc/os-release")
@@ -143,6 +114,82 @@ func installDocker() error {
 	return installCmd.Run()
 }
 
+func installPodman() error {
+	// Detect Linux distribution
+	cmd := exec.Command("cat", "/etc/os-release")
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to detect Linux distribution: %v", err)
+	}
+	osRelease := string(output)
+
+	// wireguard-tools is needed by Gerbil on the host. netavark and aardvark-dns
+	// provide container DNS so the services can reach each other by name.
+	const packages = "podman podman-compose wireguard-tools"
+	const networkPackages = "netavark aardvark-dns"
+
+	var installCmd *exec.Cmd
+	switch {
+	case strings.Contains(osRelease, "ID=ubuntu") || strings.Contains(osRelease, "ID=debian"):
+		// Ubuntu 22.04 and Debian 11 do not ship netavark, their Podman uses CNI
+		// networks and resolves container names with the dnsname plugin
+		installCmd = exec.Command("bash", "-c", fmt.Sprintf(`
+			apt-get update &&
+			apt-get install -y %s &&
+			if apt-cache show %s >/dev/null 2>&1; then
+				apt-get install -y %s
+			else
+				apt-get install -y golang-github-containernetworking-plugin-dnsname ||
+					echo "Warning: no DNS plugin for Podman networks is available, the containers may not reach each other by name"
+			fi
+		`, packages, networkPackages, networkPackages))
+	case strings.Contains(osRelease, "ID=fedora"):
+		installCmd = exec.Command("bash", "-c", fmt.Sprintf(`
+			dnf install -y %s %s
+		`, packages, networkPackages))
+	case strings.Contains(osRelease, "ID=\"almalinux\"") || strings.Contains(osRelease, "ID=\"rocky\""):
+		// podman-compose is shipped in EPEL
+		installCmd = exec.Command("bash", "-c", fmt.Sprintf(`
+			dnf install -y epel-release &&
+			dnf install -y %s %s
+		`, packages, networkPackages))
+	case strings.Contains(osRelease, "ID=rhel") || strings.Contains(osRelease, "ID=\"rhel"):
+		installCmd = exec.Command("bash", "-c", fmt.Sprintf(`
+			dnf install -y https://dl.fedoraproject.org/pub/epel/epel-release-latest-$(rpm -E %%rhel).noarch.rpm &&
+			dnf install -y %s %s
+		`, packages, networkPackages))
+	case strings.Contains(osRelease, "ID=opensuse") || strings.Contains(osRelease, "ID=\"opensuse-"):
+		installCmd = exec.Command("bash", "-c", fmt.Sprintf(`
+			zypper install -y %s %s
+		`, packages, networkPackages))
+	case strings.Contains(osRelease, "ID=arch"):
+		// Arch does not support partial upgrades, so the package database is
+		// not refreshed without upgrading the system
+		installCmd = exec.Command("bash", "-c", fmt.Sprintf(`
+			pacman -S --needed --noconfirm %s %s
+		`, packages, networkPackages))
+	default:
+		return fmt.Errorf("unsupported Linux distribution")
+	}
+
+	installCmd.Stdout = os.Stdout
+	installCmd.Stderr = os.Stderr
+	if err := installCmd.Run(); err != nil {
+		return err
+	}
+
+	// The API socket is used by tools that expect a Docker compatible endpoint
+	if err := run("systemctl", "enable", "--now", "podman.socket"); err != nil {
+		fmt.Println("Error enabling podman.socket:", err)
+	}
+
+	if !isPodmanRunning() {
+		return fmt.Errorf("podman was installed but `podman info` failed")
+	}
+
+	return nil
+}
+
 func startDockerService() error {
 	switch runtime.GOOS {
 	case "linux":
@@ -166,6 +213,22 @@ func isPodmanInstalled() bool {
 	return isContainerInstalled("podman") && isContainerInstalled("podman-compose")
 }
 
+// requirePodmanCompose exits if podman-compose, which the compose based Podman
+// setup relies on, is missing.
+func requirePodmanCompose() {
+	if !isContainerInstalled("podman-compose") {
+		if os.Geteuid() == 0 && runtime.GOOS == "linux" && readBool("podman-compose is not installed. Would you like to install it?", true) {
+			if err := installPodman(); err != nil {
+				fmt.Printf("Error installing podman-compose: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		fmt.Println("podman-compose is not installed. Please install it manually or run this installer as root.")
+		os.Exit(1)
+	}
+}
+
 func isContainerInstalled(container string) bool {
 	cmd := exec.Command(container, "--version")
 	if err := cmd.Run(); err != nil {
@@ -202,8 +265,13 @@ func isUserInDockerGroup() bool {
 	return false
 }
 
-// isDockerRunning checks if the Docker daemon is running by using the `docker info` command.
+// isDockerRunning checks if the Docker daemon is running by pinging its API,
+// falling back to the `docker info` command.
 func isDockerRunning() bool {
+	if _, err := newEngineClient(Docker); err == nil {
+		return true
+	}
+
 	cmd := exec.Command("docker", "info")
 	if err := cmd.Run(); err != nil {
 		return false
@@ -212,6 +280,10 @@ func isDockerRunning() bool {
 }
 
 func isPodmanRunning() bool {
+	if _, err := newEngineClient(Podman); err == nil {
+		return true
+	}
+
 	cmd := exec.Command("podman", "info")
 	if err := cmd.Run(); err != nil {
 		return false
@@ -219,156 +291,131 @@ func isPodmanRunning() bool {
 	return true
 }
 
-// detectContainerType detects whether the system is currently using Docker or Podman
-// by checking which container runtime is running and has containers
+// detectContainerType detects which container runtime the system is currently
+// using by checking which one is running and has containers. The --runtime
+// and --docker-context flags take precedence.
 func detectContainerType() SupportedContainer {
-	// Check if we have running containers with podman
-	if isPodmanRunning() {
-		cmd := exec.Command("podman", "ps", "-q")
-		output, err := cmd.Output()
-		if err == nil && len(strings.TrimSpace(string(output))) > 0 {
-			return Podman
-		}
+	if containerType := containerTypeFromFlags(); containerType != Undefined {
+		return containerType
 	}
 
-	// Check if we have running containers with docker
-	if isDockerRunning() {
-		cmd := exec.Command("docker", "ps", "-q")
-		output, err := cmd.Output()
-		if err == nil && len(strings.TrimSpace(string(output))) > 0 {
-			return Docker
-		}
+	if name := activeDockerContext(); name != "" {
+		dockerContextName = name
 	}
 
-	// If no containers are running, check which one is installed and running
-	if isPodmanRunning() && isPodmanInstalled() {
-		return Podman
+	candidates := []SupportedContainer{Podman, Docker, Nerdctl}
+	if dockerContextName != "" {
+		candidates = []SupportedContainer{DockerContext, Podman, Nerdctl}
 	}
 
-	if isDockerRunning() && isDockerInstalled() {
-		return Docker
+	// Check which runtime has running containers
+	for _, containerType := range candidates {
+		rt, err := containerRuntime(containerType)
+		if err == nil && rt.HasContainers() {
+			return containerType
+		}
+	}
+
+	// If no containers are running, check which one is installed and running
+	for _, containerType := range candidates {
+		if isRuntimeInstalled(containerType) && isRuntimeRunning(containerType) {
+			return containerType
+		}
 	}
 
 	return Undefined
 }
 
-// executeDockerComposeCommandWithArgs executes the appropriate docker command with arguments supplied
-func executeDockerComposeCommandWithArgs(args ...string) error {
-	var cmd *exec.Cmd
-	var useNewStyle bool
-
-	if !isDockerInstalled() {
-		return fmt.Errorf("docker is not installed")
-	}
+var (
+	composeStyleOnce sync.Once
+	composeNewStyle  bool
+	composeStyleErr  error
+)
 
-	checkCmd := exec.Command("docker", "compose", "version")
-	if err := checkCmd.Run(); err == nil {
-		useNewStyle = true
-	} else {
-		checkCmd = exec.Command("docker-compose", "version")
-		if err := checkCmd.Run(); err == nil {
-			useNewStyle = false
-		} else {
-			return fmt.Errorf("neither 'docker compose' nor 'docker-compose' command is available")
+// detectComposeStyle probes once whether the compose plugin (`docker compose`)
+// or the standalone `docker-compose` binary is available.
+func detectComposeStyle() (bool, error) {
+	composeStyleOnce.Do(func() {
+		if exec.Command("docker", "compose", "version").Run() == nil {
+			composeNewStyle = true
+			return
 		}
+		if exec.Command("docker-compose", "version").Run() != nil {
+			composeStyleErr = fmt.Errorf("neither 'docker compose' nor 'docker-compose' command is available")
+		}
+	})
+	return composeNewStyle, composeStyleErr
+}
+
+// pullContainers pulls the containers using the appropriate command.
+func pullContainers(containerType SupportedContainer) error {
+	if activeBundle != nil {
+		return activeBundle.loadImages(containerType)
 	}
 
-	if useNewStyle {
-		cmd = exec.Command("docker", append([]string{"compose"}, args...)...)
-	} else {
-		cmd = exec.Command("docker-compose", args...)
+	rt, err := containerRuntime(containerType)
+	if err != nil {
+		return err
 	}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
+	if err := rt.Login(); err != nil {
+		return err
+	}
 
-// pullContainers pulls the containers using the appropriate command.
-func pullContainers(containerType SupportedContainer) error {
 	fmt.Println("Pulling the container images...")
-	if containerType == Podman {
-		if err := run("podman-compose", "-f", "docker-compose.yml", "pull"); err != nil {
-			return fmt.Errorf("failed to pull the containers: %v", err)
-		}
 
-		return nil
+	if err := rt.Pull(); err != nil {
+		return fmt.Errorf("failed to pull the containers: %v", err)
 	}
 
-	if containerType == Docker {
-		if err := executeDockerComposeCommandWithArgs("-f", "docker-compose.yml", "pull", "--policy", "always"); err != nil {
-			return fmt.Errorf("failed to pull the containers: %v", err)
-		}
-
-		return nil
+	if err := verifyPulledImages(containerType, "docker-compose.yml"); err != nil {
+		return err
 	}
 
-	return fmt.Errorf("unsupported container type: %s", containerType)
+	return nil
 }
 
 // startContainers starts the containers using the appropriate command.
 func startContainers(containerType SupportedContainer) error {
 	fmt.Println("Starting containers...")
-
-	if containerType == Podman {
-		if err := run("podman-compose", "-f", "docker-compose.yml", "up", "-d", "--force-recreate"); err != nil {
-			return fmt.Errorf("failed start containers: %v", err)
-		}
-
-		return nil
+	rt, err := containerRuntime(containerType)
+	if err != nil {
+		return err
 	}
 
-	if containerType == Docker {
-		if err := executeDockerComposeCommandWithArgs("-f", "docker-compose.yml", "up", "-d", "--force-recreate"); err != nil {
-			return fmt.Errorf("failed to start containers: %v", err)
-		}
-
-		return nil
+	if err := rt.Up(); err != nil {
+		return fmt.Errorf("failed to start containers: %v", err)
 	}
 
-	return fmt.Errorf("unsupported container type: %s", containerType)
+	return nil
 }
 
 // stopContainers stops the containers using the appropriate command.
 func stopContainers(containerType SupportedContainer) error {
 	fmt.Println("Stopping containers...")
-	if containerType == Podman {
-		if err := run("podman-compose", "-f", "docker-compose.yml", "down"); err != nil {
-			return fmt.Errorf("failed to stop containers: %v", err)
-		}
-
-		return nil
+	rt, err := containerRuntime(containerType)
+	if err != nil {
+		return err
 	}
 
-	if containerType == Docker {
-		if err := executeDockerComposeCommandWithArgs("-f", "docker-compose.yml", "down"); err != nil {
-			return fmt.Errorf("failed to stop containers: %v", err)
-		}
-
-		return nil
+	if err := rt.Down(); err != nil {
+		return fmt.Errorf("failed to stop containers: %v", err)
 	}
 
-	return fmt.Errorf("unsupported container type: %s", containerType)
+	return nil
 }
 
 // restartContainer restarts a specific container using the appropriate command.
 func restartContainer(container string, containerType SupportedContainer) error {
 	fmt.Println("Restarting containers...")
-	if containerType == Podman {
-		if err := run("podman-compose", "-f", "docker-compose.yml", "restart"); err != nil {
-			return fmt.Errorf("failed to stop the container \"%s\": %v", container, err)
-		}
-
-		return nil
+	rt, err := containerRuntime(containerType)
+	if err != nil {
+		return err
 	}
 
-	if containerType == Docker {
-		if err := executeDockerComposeCommandWithArgs("-f", "docker-compose.yml", "restart", container); err != nil {
-			return fmt.Errorf("failed to stop the container \"%s\": %v", container, err)
-		}
-
-		return nil
+	if err := rt.Restart(container); err != nil {
+		return fmt.Errorf("failed to restart the container \"%s\": %v", container, err)
 	}
 
-	return fmt.Errorf("unsupported container type: %s", containerType)
+	return nil
 }
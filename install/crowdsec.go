@@ -2,16 +2,28 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
+// traefikBouncerName is the name the Traefik plugin is registered with in
+// CrowdSec. The crowdsec image registers it from BOUNCER_KEY_traefik.
+const traefikBouncerName = "traefik"
+
+const (
+	// traefikLogVolume mounts the Traefik access log CrowdSec reads.
+	traefikLogVolume     = "./config/traefik/logs:/var/log/traefik"
+	traefikLogrotateFile = "/etc/logrotate.d/pangolin-traefik"
+)
+
+// installCrowdsec adds CrowdSec to an existing installation.
 func installCrowdsec(config Config, installDir string) error {
 
 	if err := stopContainers(config.InstallationContainerType); err != nil {
@@ -23,94 +35,156 @@ func installCrowdsec(config Config, installDir string) error {
 		return fmt.Errorf("backup failed: %v", err)
 	}
 
-	if err := createConfigFiles(config); err != nil {
-		fmt.Printf("Error creating config files: %v\n", err)
-		os.Exit(1)
+	if err := addCrowdsecConfig(&config, installDir); err != nil {
+		return err
+	}
+
+	if err := pullContainers(config.InstallationContainerType); err != nil {
+		return err
+	}
+	if err := lockImages(config.InstallationContainerType, "docker-compose.yml", false); err != nil {
+		return err
+	}
+
+	if err := startContainers(config.InstallationContainerType); err != nil {
+		return fmt.Errorf("failed to start containers: %v", err)
+	}
+
+	return finishCrowdsecInstall(config)
+}
+
+// addCrowdsecConfig renders the CrowdSec files and merges them into the
+// compose file and the Traefik configuration. The bouncer key is generated
+// here and handed to CrowdSec through BOUNCER_KEY_traefik, so the bouncer
+// exists before Traefik starts for the first time.
+func addCrowdsecConfig(config *Config, installDir string) error {
+	crowdsecConfig := *config
+	crowdsecConfig.DoCrowdsecInstall = true
+	if crowdsecConfig.TraefikBouncerKey == "" {
+		crowdsecConfig.TraefikBouncerKey = generateBouncerKey()
+	}
+	config.TraefikBouncerKey = crowdsecConfig.TraefikBouncerKey
+	if crowdsecConfig.InstallFirewallBouncer && crowdsecConfig.FirewallBouncerKey == "" {
+		crowdsecConfig.FirewallBouncerKey = generateBouncerKey()
+	}
+	config.FirewallBouncerKey = crowdsecConfig.FirewallBouncerKey
+	if crowdsecConfig.CrowdsecInstanceName == "" {
+		crowdsecConfig.CrowdsecInstanceName = crowdsecInstanceName(crowdsecConfig.DashboardDomain)
+	}
+
+	if err := createConfigFiles(crowdsecConfig); err != nil {
+		return fmt.Errorf("error creating config files: %v", err)
 	}
 
 	if err := os.MkdirAll("config/crowdsec/db", 0755); err != nil {
-		fmt.Printf("Error creating config files: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error creating config files: %v", err)
 	}
 	if err := os.MkdirAll("config/crowdsec/acquis.d", 0755); err != nil {
-		fmt.Printf("Error creating config files: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error creating config files: %v", err)
 	}
 	if err := os.MkdirAll("config/traefik/logs", 0755); err != nil {
-		fmt.Printf("Error creating config files: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error creating config files: %v", err)
 	}
 
 	setupTraefikLogRotate(installDir)
 
 	if err := copyDockerService("config/crowdsec/docker-compose.yml", "docker-compose.yml", "crowdsec"); err != nil {
-		fmt.Printf("Error copying docker service: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error copying docker service: %v", err)
+	}
+
+	subnet, err := chooseStaticSubnet()
+	if err != nil {
+		return err
+	}
+	if err := assignStaticAddresses("docker-compose.yml", subnet); err != nil {
+		return fmt.Errorf("error assigning static addresses: %v", err)
+	}
+
+	if crowdsecConfig.CrowdsecPangolinLogs {
+		if err := enablePangolinLogs("config/config.yml"); err != nil {
+			return fmt.Errorf("error enabling the Pangolin logs: %v", err)
+		}
+	}
+
+	if crowdsecConfig.CaptchaProvider != "" {
+		if err := checkAndAddServiceVolume("docker-compose.yml", "traefik", captchaVolume); err != nil {
+			return fmt.Errorf("error mounting the captcha page: %v", err)
+		}
 	}
 
 	if err := MergeYAML("config/traefik/traefik_config.yml", "config/crowdsec/traefik_config.yml"); err != nil {
-		fmt.Printf("Error copying entry points: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error copying entry points: %v", err)
 	}
 	// delete the 2nd file
 	if err := os.Remove("config/crowdsec/traefik_config.yml"); err != nil {
-		fmt.Printf("Error removing file: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error removing file: %v", err)
 	}
 
 	if err := MergeYAML("config/traefik/dynamic_config.yml", "config/crowdsec/dynamic_config.yml"); err != nil {
-		fmt.Printf("Error copying entry points: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error copying entry points: %v", err)
 	}
 	// delete the 2nd file
 	if err := os.Remove("config/crowdsec/dynamic_config.yml"); err != nil {
-		fmt.Printf("Error removing file: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error removing file: %v", err)
 	}
 
 	if err := os.Remove("config/crowdsec/docker-compose.yml"); err != nil {
-		fmt.Printf("Error removing file: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error removing file: %v", err)
 	}
 
 	if err := CheckAndAddTraefikLogVolume("docker-compose.yml"); err != nil {
-		fmt.Printf("Error checking and adding Traefik log volume: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error checking and adding Traefik log volume: %v", err)
 	}
 
 	// check and add the service dependency of crowdsec to traefik
 	if err := CheckAndAddCrowdsecDependency("docker-compose.yml"); err != nil {
-		fmt.Printf("Error adding crowdsec dependency to traefik: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error adding crowdsec dependency to traefik: %v", err)
 	}
 
-	if err := startContainers(config.InstallationContainerType); err != nil {
-		return fmt.Errorf("failed to start containers: %v", err)
-	}
+	return nil
+}
 
-	// get API key
-	apiKey, err := GetCrowdSecAPIKey(config.InstallationContainerType)
-	if err != nil {
-		return fmt.Errorf("failed to get API key: %v", err)
+// finishCrowdsecInstall waits for CrowdSec and makes sure the Traefik bouncer
+// is registered with the key from the Traefik configuration. The firewall
+// bouncer is installed last because it needs the running LAPI.
+func finishCrowdsecInstall(config Config) error {
+	// CrowdSec's LAPI must be up before the bouncer can be checked
+	ctx, cancel := context.WithTimeout(context.Background(), containerWaitTimeout())
+	defer cancel()
+	if err := waitForContainers(ctx, config.InstallationContainerType, "pangolin", "crowdsec"); err != nil {
+		return fmt.Errorf("containers did not become healthy: %w", err)
 	}
-	config.TraefikBouncerKey = apiKey
 
-	if err := replaceInFile("config/traefik/dynamic_config.yml", "PUT_YOUR_BOUNCER_KEY_HERE_OR_IT_WILL_NOT_WORK", config.TraefikBouncerKey); err != nil {
-		return fmt.Errorf("failed to replace bouncer key: %v", err)
+	if err := syncCrowdsecTrustedIPs(config.InstallationContainerType); err != nil {
+		fmt.Printf("Warning: could not update the CrowdSec trusted IPs: %v\n", err)
 	}
 
-	if err := restartContainer("traefik", config.InstallationContainerType); err != nil {
-		return fmt.Errorf("failed to restart containers: %v", err)
+	if err := ensureBouncer(config.InstallationContainerType, traefikBouncerName, config.TraefikBouncerKey); err != nil {
+		fmt.Println("Failed to register the Traefik bouncer! Register it with the key from config/traefik/dynamic_config.yml using the following command:")
+		fmt.Printf("	%s exec crowdsec cscli bouncers add %s -k <key>\n", runtimeCLI(config.InstallationContainerType), traefikBouncerName)
+		return err
 	}
 
-	if checkIfTextInFile("config/traefik/dynamic_config.yml", "PUT_YOUR_BOUNCER_KEY_HERE_OR_IT_WILL_NOT_WORK") {
-		fmt.Println("Failed to replace bouncer key! Please retrieve the key and replace it in the config/traefik/dynamic_config.yml file using the following command:")
-		fmt.Printf("	%s exec crowdsec cscli bouncers add traefik-bouncer\n", config.InstallationContainerType)
+	if config.InstallFirewallBouncer {
+		if err := installFirewallBouncer(config); err != nil {
+			fmt.Printf("Warning: could not set up the firewall bouncer: %v\n", err)
+			fmt.Printf("Install it manually, register it with `cscli bouncers add %s` and point it at http://%s/\n", firewallBouncerName, crowdsecLAPIAddress)
+		}
 	}
 
 	return nil
 }
 
+// readCrowdsecChoice asks whether CrowdSec should be installed and makes sure
+// the user is prepared to manage it.
+func readCrowdsecChoice() bool {
+	if !readBool("Would you like to install CrowdSec?", false) {
+		return false
+	}
+	fmt.Println("This installer constitutes a minimal viable CrowdSec deployment. CrowdSec will add extra complexity to your Pangolin installation and may not work to the best of its abilities out of the box. Users are expected to implement configuration adjustments on their own to achieve the best security posture. Consult the CrowdSec documentation for detailed configuration instructions.")
+	return readBool("Are you willing to manage CrowdSec?", false)
+}
+
 func checkIsCrowdsecInstalledInCompose() bool {
 	// Read docker-compose.yml
 	content, err := os.ReadFile("docker-compose.yml")
@@ -122,28 +196,30 @@ func checkIsCrowdsecInstalledInCompose() bool {
 	return bytes.Contains(content, []byte("crowdsec:"))
 }
 
-func GetCrowdSecAPIKey(containerType SupportedContainer) (string, error) {
-	// First, ensure the container is running
-	if err := waitForContainer("crowdsec", containerType); err != nil {
-		return "", fmt.Errorf("waiting for container: %w", err)
+// generateBouncerKey returns a random key for the Traefik bouncer.
+func generateBouncerKey() string {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("Failed to generate bouncer key: %v", err))
 	}
+	return hex.EncodeToString(key)
+}
 
-	// Execute the command to get the API key
-	cmd := exec.Command(string(containerType), "exec", "crowdsec", "cscli", "bouncers", "add", "traefik-bouncer", "-o", "raw")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("executing command: %w", err)
+// ensureBouncer registers the bouncer name with key unless it exists. CrowdSec
+// registers the Traefik bouncer itself from BOUNCER_KEY_traefik when it starts.
+func ensureBouncer(containerType SupportedContainer, name, key string) error {
+	bouncers, err := listCrowdsecBouncers(containerType)
+	if err != nil {
+		return err
 	}
-
-	// Trim any whitespace from the output
-	apiKey := strings.TrimSpace(out.String())
-	if apiKey == "" {
-		return "", fmt.Errorf("empty API key returned")
+	for _, bouncer := range bouncers {
+		if bouncer.Name == name {
+			return nil
+		}
 	}
 
-	return apiKey, nil
+	_, err = runCscli(containerType, "bouncers", "add", name, "-k", key)
+	return err
 }
 
 func checkIfTextInFile(file, text string) bool {
@@ -221,7 +297,7 @@ func CheckAndAddCrowdsecDependency(composePath string) error {
 // the rotated copy is made and the original is truncated in place.
 func setupTraefikLogRotate(installDir string) {
 	const logrotateDir = "/etc/logrotate.d"
-	const logrotateFile = "/etc/logrotate.d/pangolin-traefik"
+	const logrotateFile = traefikLogrotateFile
 
 	logPath := filepath.Join(installDir, "config/traefik/logs/access.log")
 
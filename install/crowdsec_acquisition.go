@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// hostSSHLogs are the files distributions log SSH logins to, by preference.
+var hostSSHLogs = []string{"/var/log/auth.log", "/var/log/secure"}
+
+// pangolinLogKeys are the settings under app in config.yml that make Pangolin
+// log the failed authentication attempts to a file.
+var pangolinLogKeys = []string{"save_logs", "log_failed_attempts"}
+
+// pangolinLogsComment marks the settings enablePangolinLogs turned on, so
+// removing CrowdSec only turns those off again.
+const pangolinLogsComment = "# Enabled for CrowdSec by the installer"
+
+// pangolinLogFiles are the CrowdSec files that read the logs of Pangolin.
+var pangolinLogFiles = []string{
+	"config/crowdsec/acquis.d/pangolin.yaml",
+	"config/crowdsec/parsers/s01-parse/pangolin-logs.yaml",
+	"config/crowdsec/scenarios/pangolin-bf.yaml",
+}
+
+// collectCrowdsecTuningInput asks how AppSec behaves and which logs besides
+// the Traefik access log CrowdSec reads, and whether it trusts the LAN.
+func collectCrowdsecTuningInput(config *Config) {
+	fmt.Println("AppSec inspects HTTP requests for known exploits before Traefik forwards them.")
+	config.CrowdsecAppsec = readBool("Do you want to enable CrowdSec AppSec?", true)
+	if config.CrowdsecAppsec {
+		fmt.Println("When AppSec is down or fails to answer, requests can be blocked (fail closed) or let through (fail open).")
+		config.CrowdsecAppsecFailClosed = readBool("Do you want to block all requests while AppSec is unavailable?", false)
+		config.CrowdsecAppsecBodyLimit = readInt("Enter the request body size AppSec inspects in MB", 10) * 1024 * 1024
+	}
+
+	config.CrowdsecSSHLog = ""
+	if i := slices.IndexFunc(hostSSHLogs, fileExists); i >= 0 {
+		if readBool(fmt.Sprintf("Do you want CrowdSec to ban IPs that attack SSH, read from %s?", hostSSHLogs[i]), true) {
+			config.CrowdsecSSHLog = filepath.Base(hostSSHLogs[i])
+		}
+	} else {
+		fmt.Println("SSH logins are only in the journal on this host, which the CrowdSec container cannot read. Install rsyslog to have them written to /var/log/auth.log or /var/log/secure.")
+	}
+
+	config.CrowdsecPangolinLogs = readBool("Do you want CrowdSec to ban IPs with repeated failed Pangolin logins? This turns on save_logs and log_failed_attempts in config.yml.", true)
+
+	fmt.Println("The private LAN ranges 10.0.0.0/8, 172.16.0.0/12 and 192.168.0.0/16 contain the container networks. Trusting them also trusts clients that reach Pangolin through the gateway of the Docker network.")
+	config.CrowdsecTrustLAN = readBool("Do you want CrowdSec to never block private LAN addresses?", false)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// CrowdsecCollections returns the hub collections the crowdsec container
+// installs on startup.
+func (c Config) CrowdsecCollections() string {
+	collections := []string{"crowdsecurity/traefik"}
+	if c.CrowdsecAppsec {
+		collections = append(collections, "crowdsecurity/appsec-virtual-patching", "crowdsecurity/appsec-generic-rules")
+	}
+	if c.CrowdsecSSHLog != "" {
+		// The syslog parsers and the sshd scenarios
+		collections = append(collections, "crowdsecurity/linux")
+	}
+	return strings.Join(collections, " ")
+}
+
+// crowdsecFileEnabled reports whether the embedded file at path belongs to a
+// chosen CrowdSec feature, or to no optional feature at all.
+func crowdsecFileEnabled(config Config, path string) bool {
+	switch {
+	case path == "config/crowdsec/captcha.html":
+		return config.CaptchaProvider != ""
+	case path == "config/crowdsec/acquis.d/appsec.yaml":
+		return config.CrowdsecAppsec
+	case path == "config/crowdsec/acquis.d/ssh.yaml":
+		return config.CrowdsecSSHLog != ""
+	case slices.Contains(pangolinLogFiles, path):
+		return config.CrowdsecPangolinLogs
+	}
+	if name, ok := crowdsecNotificationPlugins[path]; ok {
+		return slices.Contains(config.CrowdsecNotifications(), name)
+	}
+	return true
+}
+
+// enablePangolinLogs makes Pangolin write its log, including the failed
+// authentication attempts, to config/logs for CrowdSec.
+func enablePangolinLogs(configPath string) error {
+	if err := os.MkdirAll("config/logs", 0755); err != nil {
+		return fmt.Errorf("failed to create config/logs: %v", err)
+	}
+
+	return updateYAMLFile(configPath, func(doc *yaml.Node) error {
+		changed := false
+		for _, key := range pangolinLogKeys {
+			if node := lookupYAMLNode(doc, "app", key); node != nil && node.Value == "true" {
+				continue
+			}
+			if err := setYAMLValue(doc, true, "app", key); err != nil {
+				return err
+			}
+			lookupYAMLNode(doc, "app", key).LineComment = pangolinLogsComment
+			changed = true
+		}
+		if !changed {
+			return errYAMLUnchanged
+		}
+		return nil
+	})
+}
+
+// disablePangolinLogs turns off the settings enablePangolinLogs turned on.
+// Settings the user enabled or changed since are left alone.
+func disablePangolinLogs(configPath string) error {
+	var disabled []string
+	err := updateYAMLFile(configPath, func(doc *yaml.Node) error {
+		for _, key := range pangolinLogKeys {
+			node := lookupYAMLNode(doc, "app", key)
+			if node == nil || node.Value != "true" || node.LineComment != pangolinLogsComment {
+				continue
+			}
+			if err := setYAMLValue(doc, false, "app", key); err != nil {
+				return err
+			}
+			disabled = append(disabled, "app."+key)
+		}
+		if len(disabled) == 0 {
+			return errYAMLUnchanged
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(disabled) > 0 {
+		fmt.Printf("Turned off the Pangolin logs for CrowdSec in config/config.yml: %s\n", strings.Join(disabled, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import "testing"
+
+func TestCrowdsecCollections(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{
+			name: "traefik only",
+			want: "crowdsecurity/traefik",
+		},
+		{
+			name:   "appsec",
+			config: Config{CrowdsecAppsec: true},
+			want:   "crowdsecurity/traefik crowdsecurity/appsec-virtual-patching crowdsecurity/appsec-generic-rules",
+		},
+		{
+			name:   "ssh",
+			config: Config{CrowdsecSSHLog: "auth.log"},
+			want:   "crowdsecurity/traefik crowdsecurity/linux",
+		},
+		{
+			name:   "appsec and ssh",
+			config: Config{CrowdsecAppsec: true, CrowdsecSSHLog: "secure"},
+			want:   "crowdsecurity/traefik crowdsecurity/appsec-virtual-patching crowdsecurity/appsec-generic-rules crowdsecurity/linux",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.CrowdsecCollections(); got != tt.want {
+				t.Errorf("CrowdsecCollections() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCrowdsecFileEnabled(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		path   string
+		want   bool
+	}{
+		{
+			name: "file of no optional feature",
+			path: "config/crowdsec/acquis.d/traefik.yaml",
+			want: true,
+		},
+		{
+			name: "captcha page without a provider",
+			path: "config/crowdsec/captcha.html",
+		},
+		{
+			name:   "captcha page with a provider",
+			config: Config{CaptchaProvider: "turnstile"},
+			path:   "config/crowdsec/captcha.html",
+			want:   true,
+		},
+		{
+			name: "appsec disabled",
+			path: "config/crowdsec/acquis.d/appsec.yaml",
+		},
+		{
+			name:   "appsec enabled",
+			config: Config{CrowdsecAppsec: true},
+			path:   "config/crowdsec/acquis.d/appsec.yaml",
+			want:   true,
+		},
+		{
+			name: "ssh log not chosen",
+			path: "config/crowdsec/acquis.d/ssh.yaml",
+		},
+		{
+			name:   "ssh log chosen",
+			config: Config{CrowdsecSSHLog: "auth.log"},
+			path:   "config/crowdsec/acquis.d/ssh.yaml",
+			want:   true,
+		},
+		{
+			name: "pangolin logs disabled",
+			path: "config/crowdsec/scenarios/pangolin-bf.yaml",
+		},
+		{
+			name:   "pangolin logs enabled",
+			config: Config{CrowdsecPangolinLogs: true},
+			path:   "config/crowdsec/scenarios/pangolin-bf.yaml",
+			want:   true,
+		},
+		{
+			name:   "other notification plugin",
+			config: Config{CrowdsecWebhookURL: "https://hooks.example.com/crowdsec"},
+			path:   "config/crowdsec/notifications/slack.yaml",
+		},
+		{
+			name:   "chosen notification plugin",
+			config: Config{CrowdsecWebhookURL: "https://hooks.example.com/crowdsec"},
+			path:   "config/crowdsec/notifications/http.yaml",
+			want:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := crowdsecFileEnabled(tt.config, tt.path); got != tt.want {
+				t.Errorf("crowdsecFileEnabled(%q) = %t, want %t", tt.path, got, tt.want)
+			}
+		})
+	}
+}
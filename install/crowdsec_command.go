@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// legacyTraefikBouncerName is the bouncer name older installers registered
+// with `cscli bouncers add`.
+const legacyTraefikBouncerName = "traefik-bouncer"
+
+const crowdsecUsage = `usage: crowdsec <command>
+  remove [--purge]                      remove CrowdSec from the installation
+  sync                                  update the trusted IPs of the middleware
+  console <command>                     manage the CrowdSec Console enrollment
+  decisions [--json]                    list the active decisions
+  decisions add <ip|range> [--duration 4h] [--type ban|captcha] [--reason text]
+  decisions delete <ip|range>
+  bouncers [--json]                     list the bouncers
+  bouncers rotate <traefik|firewall>    replace the key of a bouncer
+  collections [--json]                  list the installed hub collections
+  collections install <name>...
+  collections upgrade [name...]         upgrade the given or all collections
+  notifications [--json]                list the notification plugins in use
+  notifications test [name...]          send a test alert through the plugins
+  metrics [--json]                      show the acquisition, alert and decision metrics`
+
+func runCrowdsecCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(crowdsecUsage)
+	}
+	if args[0] == "help" {
+		fmt.Println(crowdsecUsage)
+		return nil
+	}
+
+	if _, err := enterInstallDirectory(); err != nil {
+		return err
+	}
+
+	if args[0] == "remove" {
+		purge := len(args) > 1 && args[1] == "--purge"
+		return removeCrowdsec(purge)
+	}
+
+	if !checkIsCrowdsecInstalledInCompose() {
+		return fmt.Errorf("CrowdSec is not installed")
+	}
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		return fmt.Errorf("could not detect the container runtime, pass --runtime")
+	}
+
+	switch args[0] {
+	case "sync":
+		return syncCrowdsecTrustedIPs(containerType)
+	case "console":
+		return runCrowdsecConsoleCommand(containerType, args[1:])
+	case "decisions":
+		return runCrowdsecDecisionsCommand(containerType, args[1:])
+	case "bouncers":
+		return runCrowdsecBouncersCommand(containerType, args[1:])
+	case "collections":
+		return runCrowdsecCollectionsCommand(containerType, args[1:])
+	case "notifications":
+		return runCrowdsecNotificationsCommand(containerType, args[1:])
+	case "metrics":
+		return runCrowdsecMetricsCommand(containerType, args[1:])
+	}
+
+	return fmt.Errorf("unknown crowdsec command: %s\n%s", args[0], crowdsecUsage)
+}
+
+// removeCrowdsec reverses installCrowdsec. The CrowdSec data in
+// config/crowdsec is only deleted when purge is set or the user agrees.
+func removeCrowdsec(purge bool) error {
+	if !checkIsCrowdsecInstalledInCompose() {
+		return fmt.Errorf("CrowdSec is not installed")
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		return fmt.Errorf("could not detect the container runtime, pass --runtime")
+	}
+
+	if !purge {
+		purge = readBool("Do you also want to delete the CrowdSec data in config/crowdsec?", false)
+	}
+
+	if err := backupConfig(); err != nil {
+		return fmt.Errorf("backup failed: %v", err)
+	}
+
+	if err := removeFirewallBouncer(); err != nil {
+		fmt.Printf("Warning: could not remove the firewall bouncer: %v\n", err)
+	}
+	if err := removeCrowdsecBouncers(containerType); err != nil {
+		fmt.Printf("Warning: could not remove the bouncers: %v\n", err)
+	}
+
+	if err := stopContainers(containerType); err != nil {
+		return fmt.Errorf("failed to stop containers: %v", err)
+	}
+
+	if err := removeCrowdsecFromCompose("docker-compose.yml"); err != nil {
+		return err
+	}
+	if err := unlockService("crowdsec"); err != nil {
+		return err
+	}
+
+	for _, file := range []struct{ installed, base, overlay string }{
+		{"config/traefik/traefik_config.yml", "config/traefik/traefik_config.yml", "config/crowdsec/traefik_config.yml"},
+		{"config/traefik/dynamic_config.yml", "config/traefik/dynamic_config.yml", "config/crowdsec/dynamic_config.yml"},
+	} {
+		if err := unmergeEmbeddedConfig(file.installed, file.base, file.overlay); err != nil {
+			return err
+		}
+	}
+
+	// The middleware can hold keys the overlay does not render, like the
+	// synced trusted IPs, so it is removed as a whole
+	if err := updateYAMLFile("config/traefik/dynamic_config.yml", func(doc *yaml.Node) error {
+		if !deleteYAMLValue(doc, crowdsecPluginPath[:3]...) {
+			return errYAMLUnchanged
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Bundle installations load the plugin locally
+	if err := updateYAMLFile("config/traefik/traefik_config.yml", func(doc *yaml.Node) error {
+		if !deleteYAMLValue(doc, "experimental", "localPlugins", "crowdsec") {
+			return errYAMLUnchanged
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := disablePangolinLogs("config/config.yml"); err != nil {
+		fmt.Printf("Warning: could not turn off the Pangolin logs: %v\n", err)
+	}
+
+	if err := os.Remove(traefikLogrotateFile); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: could not remove %s: %v\n", traefikLogrotateFile, err)
+	}
+
+	if purge {
+		if err := os.RemoveAll("config/crowdsec"); err != nil {
+			return fmt.Errorf("failed to delete config/crowdsec: %v", err)
+		}
+		fmt.Println("Deleted config/crowdsec.")
+	}
+
+	if err := startContainers(containerType); err != nil {
+		return fmt.Errorf("failed to start containers: %v", err)
+	}
+
+	fmt.Println("CrowdSec removed. The previous configuration was saved to config.tar.gz and docker-compose.yml.backup.")
+	return nil
+}
+
+// removeCrowdsecBouncers deletes the bouncer registrations of Traefik and the
+// firewall while CrowdSec is still running.
+func removeCrowdsecBouncers(containerType SupportedContainer) error {
+	bouncers, err := listCrowdsecBouncers(containerType)
+	if err != nil {
+		return err
+	}
+
+	for _, bouncer := range bouncers {
+		if !isBouncerOf(bouncer.Name, traefikBouncerName) && !isBouncerOf(bouncer.Name, firewallBouncerName) {
+			continue
+		}
+		if _, err := runCscli(containerType, "bouncers", "delete", bouncer.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeCrowdsecFromCompose removes the crowdsec service, the dependency of
+// the traefik service on it and the captcha page mount.
+func removeCrowdsecFromCompose(composePath string) error {
+	return updateYAMLFile(composePath, func(doc *yaml.Node) error {
+		deleteYAMLValue(doc, "services", "crowdsec")
+
+		if deleteYAMLValue(doc, "services", "traefik", "depends_on", "crowdsec") {
+			if dependsOn := lookupYAMLNode(doc, "services", "traefik", "depends_on"); dependsOn != nil && len(dependsOn.Content) == 0 {
+				deleteYAMLValue(doc, "services", "traefik", "depends_on")
+			}
+		}
+
+		// The log volume stays, the compose template mounts it for every
+		// installation
+		if volumes := lookupYAMLNode(doc, "services", "traefik", "volumes"); volumes != nil && volumes.Kind == yaml.SequenceNode {
+			for i, volume := range volumes.Content {
+				if volume.Value == captchaVolume {
+					volumes.Content = append(volumes.Content[:i], volumes.Content[i+1:]...)
+					break
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// unmergeEmbeddedConfig removes what the overlay template added to the
+// installed file. Both templates are rendered with the same values so only the
+// differences between them are reverted.
+func unmergeEmbeddedConfig(installed, basePath, overlayPath string) error {
+	var config Config
+	base, err := renderEmbeddedConfig(basePath, config)
+	if err != nil {
+		return err
+	}
+	overlay, err := renderEmbeddedConfig(overlayPath, config)
+	if err != nil {
+		return err
+	}
+
+	if err := UnmergeYAML(installed, []byte(base), []byte(overlay)); err != nil {
+		return fmt.Errorf("error reverting %s: %v", installed, err)
+	}
+	return nil
+}
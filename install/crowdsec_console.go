@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// consoleFeatures are the data sharing options of `cscli console enable`.
+// CrowdSec stores them in config/crowdsec/console.yaml, which the container
+// mounts, so they survive a recreated container.
+var consoleFeatures = []string{"manual", "tainted", "custom", "context", "console_management", "all"}
+
+// crowdsecInstanceName returns the name the instance is enrolled with in the
+// CrowdSec Console.
+func crowdsecInstanceName(dashboardDomain string) string {
+	if dashboardDomain == "" {
+		return "pangolin-crowdsec"
+	}
+	return dashboardDomain
+}
+
+// collectCrowdsecConsoleInput asks for the CrowdSec Console enrollment key
+// and the data shared with the console.
+func collectCrowdsecConsoleInput(config *Config) {
+	fmt.Println("The CrowdSec Console (https://app.crowdsec.net) shows the alerts and decisions of your instances. Enrolling needs the enrollment key from the console.")
+	config.CrowdsecEnrollKey = strings.TrimSpace(readOptionalString("Enter the CrowdSec Console enrollment key (leave empty to skip)", ""))
+	if config.CrowdsecEnrollKey == "" {
+		return
+	}
+
+	config.CrowdsecInstanceName = readString("Enter the instance name to show in the console", crowdsecInstanceName(config.DashboardDomain))
+	config.CrowdsecShareDecisions = readBool("Do you want to share the decisions you add with cscli with the console?", false)
+	config.CrowdsecShareContext = readBool("Do you want to share the context of alerts, like the requested URLs, with the console?", false)
+	fmt.Println("Accept the enrollment in the console once CrowdSec has started.")
+}
+
+// runCrowdsecConsoleCommand handles `crowdsec console`.
+func runCrowdsecConsoleCommand(containerType SupportedContainer, args []string) error {
+	const usage = "usage: crowdsec console status | enroll <key> [name] | enable|disable <feature>..."
+	if len(args) == 0 {
+		return fmt.Errorf(usage)
+	}
+
+	switch args[0] {
+	case "status":
+		output, err := runCscli(containerType, "console", "status")
+		if err != nil {
+			return err
+		}
+		fmt.Print(output)
+		return nil
+	case "enroll":
+		if len(args) < 2 {
+			return fmt.Errorf(usage)
+		}
+		name := ""
+		if len(args) > 2 {
+			name = args[2]
+		}
+		return enrollCrowdsecConsole(containerType, args[1], name)
+	case "enable", "disable":
+		if len(args) < 2 {
+			return fmt.Errorf("%s\nfeatures: %s", usage, strings.Join(consoleFeatures, ", "))
+		}
+		for _, feature := range args[1:] {
+			if !slices.Contains(consoleFeatures, feature) {
+				return fmt.Errorf("unknown console feature %q, expected one of %s", feature, strings.Join(consoleFeatures, ", "))
+			}
+		}
+		if _, err := runCscli(containerType, append([]string{"console", args[0]}, args[1:]...)...); err != nil {
+			return err
+		}
+		// CrowdSec reads console.yaml on startup
+		if err := restartContainer("crowdsec", containerType); err != nil {
+			return err
+		}
+		fmt.Printf("Console feature(s) %sd: %s\n", args[0], strings.Join(args[1:], ", "))
+		return nil
+	}
+
+	return fmt.Errorf("unknown console command: %s", args[0])
+}
+
+// enrollCrowdsecConsole enrolls the running CrowdSec instance and stores the
+// key in the compose file, so a recreated container enrolls again. The name
+// defaults to the dashboard domain.
+func enrollCrowdsecConsole(containerType SupportedContainer, key, name string) error {
+	if name == "" {
+		appConfig, err := ReadAppConfig("config/config.yml")
+		if err != nil {
+			return err
+		}
+		dashboardURL, err := url.Parse(appConfig.DashboardURL)
+		if err != nil {
+			return fmt.Errorf("error parsing the dashboard URL: %w", err)
+		}
+		name = crowdsecInstanceName(dashboardURL.Hostname())
+	}
+
+	if err := updateYAMLFile("docker-compose.yml", func(doc *yaml.Node) error {
+		if err := setYAMLValue(doc, key, "services", "crowdsec", "environment", "ENROLL_KEY"); err != nil {
+			return err
+		}
+		return setYAMLValue(doc, name, "services", "crowdsec", "environment", "ENROLL_INSTANCE_NAME")
+	}); err != nil {
+		return err
+	}
+
+	if _, err := runCscli(containerType, "console", "enroll", key, "--name", name, "--tags", "docker"); err != nil {
+		return err
+	}
+
+	fmt.Printf("Enrolled %s. Accept the enrollment in the CrowdSec Console to finish.\n", name)
+	return nil
+}
+
+// runCscli runs cscli in the CrowdSec container and returns its output.
+func runCscli(containerType SupportedContainer, args ...string) (string, error) {
+	result, err := execInContainer(containerType, "crowdsec", append([]string{"cscli"}, args...)...)
+	if err != nil {
+		return "", fmt.Errorf("executing command: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("cscli exited with code %d: %s", result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+	return result.Stdout, nil
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// crowdsecPluginPath is the path of the CrowdSec plugin options in the Traefik
+// dynamic configuration.
+var crowdsecPluginPath = []string{"http", "middlewares", "crowdsec", "plugin", "crowdsec"}
+
+type crowdsecDecision struct {
+	ID       int    `json:"id"`
+	Type     string `json:"type"`
+	Scope    string `json:"scope"`
+	Value    string `json:"value"`
+	Origin   string `json:"origin"`
+	Scenario string `json:"scenario"`
+	Duration string `json:"duration"`
+}
+
+type crowdsecBouncer struct {
+	Name      string     `json:"name"`
+	IPAddress string     `json:"ip_address"`
+	Type      string     `json:"type"`
+	Version   string     `json:"version"`
+	LastPull  *time.Time `json:"last_pull"`
+	Revoked   bool       `json:"revoked"`
+}
+
+type crowdsecCollection struct {
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	Version     string `json:"local_version"`
+	Description string `json:"description"`
+}
+
+// crowdsecMetrics is the part of `cscli metrics` the installer shows.
+type crowdsecMetrics struct {
+	// Acquisition maps a log source to its reads, parsed and unparsed lines.
+	Acquisition map[string]map[string]int `json:"acquisition"`
+	// Alerts maps a scenario to the number of alerts.
+	Alerts map[string]int `json:"alerts"`
+	// Decisions maps reason, origin and action to the active decisions.
+	Decisions map[string]map[string]map[string]int `json:"decisions"`
+}
+
+// cutJSONFlag removes --json from args and reports whether it was present.
+func cutJSONFlag(args []string) ([]string, bool) {
+	i := slices.Index(args, "--json")
+	if i < 0 {
+		return args, false
+	}
+	return slices.Delete(slices.Clone(args), i, i+1), true
+}
+
+func printJSON(value any) error {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding JSON: %w", err)
+	}
+	fmt.Println(string(content))
+	return nil
+}
+
+// runCscliJSON runs cscli with JSON output and decodes it into value.
+func runCscliJSON(containerType SupportedContainer, value any, args ...string) error {
+	output, err := runCscli(containerType, append(args, "-o", "json")...)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(output), value); err != nil {
+		return fmt.Errorf("failed to parse the output of cscli %s: %v", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// decisionTarget returns the cscli flag that selects an IP or a range.
+func decisionTarget(target string) (string, error) {
+	if _, _, err := net.ParseCIDR(target); err == nil {
+		return "--range", nil
+	}
+	if net.ParseIP(target) != nil {
+		return "--ip", nil
+	}
+	return "", fmt.Errorf("%q is neither an IP address nor a range", target)
+}
+
+func runCrowdsecDecisionsCommand(containerType SupportedContainer, args []string) error {
+	args, asJSON := cutJSONFlag(args)
+	if len(args) == 0 || args[0] == "list" {
+		return listCrowdsecDecisions(containerType, asJSON)
+	}
+
+	if len(args) < 2 {
+		return fmt.Errorf(crowdsecUsage)
+	}
+	target := args[1]
+	targetFlag, err := decisionTarget(target)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "add":
+		duration, decisionType, reason := "4h", "ban", "added with the Pangolin installer"
+		options := args[2:]
+		for i := 0; i < len(options); i++ {
+			if i+1 >= len(options) {
+				return fmt.Errorf("missing value for %s", options[i])
+			}
+			switch options[i] {
+			case "--duration":
+				duration = options[i+1]
+			case "--type":
+				decisionType = options[i+1]
+			case "--reason":
+				reason = options[i+1]
+			default:
+				return fmt.Errorf("unknown option %s", options[i])
+			}
+			i++
+		}
+		if decisionType != "ban" && decisionType != "captcha" {
+			return fmt.Errorf("unknown decision type %q, expected ban or captcha", decisionType)
+		}
+
+		if _, err := runCscli(containerType, "decisions", "add", targetFlag, target, "--duration", duration, "--type", decisionType, "--reason", reason); err != nil {
+			return err
+		}
+		fmt.Printf("Added a %s decision for %s for %s.\n", decisionType, target, duration)
+		return nil
+	case "delete":
+		if _, err := runCscli(containerType, "decisions", "delete", targetFlag, target); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted the decisions for %s.\n", target)
+		return nil
+	}
+
+	return fmt.Errorf("unknown decisions command: %s", args[0])
+}
+
+func listCrowdsecDecisions(containerType SupportedContainer, asJSON bool) error {
+	// cscli lists alerts with their decisions, or null without any
+	var alerts []struct {
+		Decisions []crowdsecDecision `json:"decisions"`
+	}
+	if err := runCscliJSON(containerType, &alerts, "decisions", "list"); err != nil {
+		return err
+	}
+
+	decisions := []crowdsecDecision{}
+	for _, alert := range alerts {
+		decisions = append(decisions, alert.Decisions...)
+	}
+	sort.Slice(decisions, func(i, j int) bool { return decisions[i].ID < decisions[j].ID })
+
+	if asJSON {
+		return printJSON(decisions)
+	}
+	if len(decisions) == 0 {
+		fmt.Println("No active decisions.")
+		return nil
+	}
+	fmt.Printf("  %-8s %-8s %-20s %-10s %-12s %s\n", "ID", "TYPE", "VALUE", "ORIGIN", "DURATION", "REASON")
+	for _, d := range decisions {
+		fmt.Printf("  %-8d %-8s %-20s %-10s %-12s %s\n", d.ID, d.Type, d.Value, d.Origin, d.Duration, d.Scenario)
+	}
+	return nil
+}
+
+// listCrowdsecBouncers returns the bouncers registered with the LAPI.
+func listCrowdsecBouncers(containerType SupportedContainer) ([]crowdsecBouncer, error) {
+	var bouncers []crowdsecBouncer
+	if err := runCscliJSON(containerType, &bouncers, "bouncers", "list"); err != nil {
+		return nil, err
+	}
+	return bouncers, nil
+}
+
+func runCrowdsecBouncersCommand(containerType SupportedContainer, args []string) error {
+	args, asJSON := cutJSONFlag(args)
+	if len(args) == 0 || args[0] == "list" {
+		bouncers, err := listCrowdsecBouncers(containerType)
+		if err != nil {
+			return err
+		}
+		if asJSON {
+			if bouncers == nil {
+				bouncers = []crowdsecBouncer{}
+			}
+			return printJSON(bouncers)
+		}
+		if len(bouncers) == 0 {
+			fmt.Println("No bouncers registered.")
+			return nil
+		}
+		fmt.Printf("  %-24s %-16s %-8s %s\n", "NAME", "IP", "STATE", "LAST PULL")
+		for _, b := range bouncers {
+			state, lastPull := "valid", "never"
+			if b.Revoked {
+				state = "revoked"
+			}
+			if b.LastPull != nil {
+				lastPull = b.LastPull.Local().Format(time.DateTime)
+			}
+			fmt.Printf("  %-24s %-16s %-8s %s\n", b.Name, b.IPAddress, state, lastPull)
+		}
+		return nil
+	}
+
+	if args[0] == "rotate" && len(args) == 2 {
+		return rotateBouncer(containerType, args[1])
+	}
+	return fmt.Errorf(crowdsecUsage)
+}
+
+func runCrowdsecCollectionsCommand(containerType SupportedContainer, args []string) error {
+	args, asJSON := cutJSONFlag(args)
+	if len(args) == 0 || args[0] == "list" {
+		var hub struct {
+			Collections []crowdsecCollection `json:"collections"`
+		}
+		if err := runCscliJSON(containerType, &hub, "collections", "list"); err != nil {
+			return err
+		}
+		if asJSON {
+			if hub.Collections == nil {
+				hub.Collections = []crowdsecCollection{}
+			}
+			return printJSON(hub.Collections)
+		}
+		fmt.Printf("  %-45s %-10s %s\n", "NAME", "VERSION", "STATUS")
+		for _, c := range hub.Collections {
+			fmt.Printf("  %-45s %-10s %s\n", c.Name, c.Version, c.Status)
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "install":
+		if len(args) < 2 {
+			return fmt.Errorf(crowdsecUsage)
+		}
+		if _, err := runCscli(containerType, "hub", "update"); err != nil {
+			return err
+		}
+		if _, err := runCscli(containerType, append([]string{"collections", "install"}, args[1:]...)...); err != nil {
+			return err
+		}
+	case "upgrade":
+		if _, err := runCscli(containerType, "hub", "update"); err != nil {
+			return err
+		}
+		upgrade := []string{"collections", "upgrade", "--all"}
+		if len(args) > 1 {
+			upgrade = append([]string{"collections", "upgrade"}, args[1:]...)
+		}
+		if _, err := runCscli(containerType, upgrade...); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown collections command: %s", args[0])
+	}
+
+	// CrowdSec loads the hub when it starts
+	if err := restartContainer("crowdsec", containerType); err != nil {
+		return err
+	}
+	fmt.Println("Collections updated.")
+	return nil
+}
+
+func runCrowdsecMetricsCommand(containerType SupportedContainer, args []string) error {
+	_, asJSON := cutJSONFlag(args)
+
+	var metrics crowdsecMetrics
+	if err := runCscliJSON(containerType, &metrics, "metrics"); err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(metrics)
+	}
+
+	fmt.Println("Acquisition:")
+	fmt.Printf("  %-50s %10s %10s %10s\n", "SOURCE", "READ", "PARSED", "UNPARSED")
+	for _, source := range sortedKeys(metrics.Acquisition) {
+		lines := metrics.Acquisition[source]
+		fmt.Printf("  %-50s %10d %10d %10d\n", source, lines["reads"], lines["parsed"], lines["unparsed"])
+	}
+
+	fmt.Println("Alerts:")
+	fmt.Printf("  %-50s %10s\n", "SCENARIO", "COUNT")
+	for _, scenario := range sortedKeys(metrics.Alerts) {
+		fmt.Printf("  %-50s %10d\n", scenario, metrics.Alerts[scenario])
+	}
+
+	fmt.Println("Active decisions:")
+	fmt.Printf("  %-50s %-10s %-8s %10s\n", "REASON", "ORIGIN", "ACTION", "COUNT")
+	for _, reason := range sortedKeys(metrics.Decisions) {
+		for _, origin := range sortedKeys(metrics.Decisions[reason]) {
+			for _, action := range sortedKeys(metrics.Decisions[reason][origin]) {
+				fmt.Printf("  %-50s %-10s %-8s %10d\n", reason, origin, action, metrics.Decisions[reason][origin][action])
+			}
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const crowdsecNotificationsDir = "config/crowdsec/notifications"
+
+// crowdsecNotificationPlugins maps the notification plugin configurations to
+// the names profiles.yaml refers to them by.
+var crowdsecNotificationPlugins = map[string]string{
+	"config/crowdsec/notifications/http.yaml":  "http_default",
+	"config/crowdsec/notifications/slack.yaml": "slack_default",
+	"config/crowdsec/notifications/email.yaml": "email_default",
+}
+
+// CrowdsecNotifications returns the notification plugins the profiles notify.
+func (c Config) CrowdsecNotifications() []string {
+	var notifications []string
+	if c.CrowdsecWebhookURL != "" {
+		notifications = append(notifications, "http_default")
+	}
+	if c.CrowdsecSlackWebhookURL != "" {
+		notifications = append(notifications, "slack_default")
+	}
+	if c.CrowdsecNotificationEmail != "" {
+		notifications = append(notifications, "email_default")
+	}
+	return notifications
+}
+
+// collectCrowdsecNotificationsInput asks where CrowdSec reports new decisions.
+// Email notifications use the SMTP settings of Pangolin.
+func collectCrowdsecNotificationsInput(config *Config) {
+	if !readBool("Do you want CrowdSec to send notifications about new decisions?", false) {
+		return
+	}
+
+	config.CrowdsecWebhookURL = hostWebhookURL(strings.TrimSpace(readOptionalString("Enter a webhook URL to post the alerts to as JSON (leave empty to skip)", "")))
+
+	slackURL := strings.TrimSpace(readOptionalString("Enter a Slack or Discord webhook URL (leave empty to skip)", ""))
+	if strings.Contains(slackURL, "discord.com/api/webhooks/") && !strings.HasSuffix(slackURL, "/slack") {
+		// Discord accepts Slack messages on the /slack endpoint
+		slackURL = strings.TrimSuffix(slackURL, "/") + "/slack"
+	}
+	config.CrowdsecSlackWebhookURL = slackURL
+
+	if config.EnableEmail {
+		if readBool("Do you want to send notifications by email using the SMTP settings of Pangolin?", false) {
+			config.CrowdsecNotificationEmail = readString("Enter the email address to notify", config.LetsEncryptEmail)
+		}
+	} else {
+		fmt.Println("Email notifications need the SMTP settings of Pangolin, which are not configured.")
+	}
+
+	if len(config.CrowdsecNotifications()) > 0 {
+		fmt.Println("Test the notifications once CrowdSec is running with: installer crowdsec notifications test")
+	}
+}
+
+// hostWebhookURL points webhooks on localhost at the host, since CrowdSec
+// posts them from its container.
+func hostWebhookURL(webhookURL string) string {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil {
+		return webhookURL
+	}
+	if host := parsed.Hostname(); host != "localhost" && host != "127.0.0.1" {
+		return webhookURL
+	}
+
+	host := "host.docker.internal"
+	if port := parsed.Port(); port != "" {
+		host += ":" + port
+	}
+	parsed.Host = host
+	fmt.Printf("CrowdSec posts to %s, so the listener has to accept connections from the containers, not only from 127.0.0.1.\n", parsed)
+	return parsed.String()
+}
+
+// crowdsecNotification is a notification plugin configuration.
+type crowdsecNotification struct {
+	Name string `yaml:"name" json:"name"`
+	Type string `yaml:"type" json:"type"`
+	File string `yaml:"-" json:"file"`
+}
+
+// readProfileNotifications returns the notification plugins the profiles in
+// profiles.yaml notify.
+func readProfileNotifications() ([]string, error) {
+	file, err := os.Open("config/crowdsec/profiles.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("error reading profiles.yaml: %w", err)
+	}
+	defer file.Close()
+
+	var names []string
+	decoder := yaml.NewDecoder(file)
+	for {
+		var profile struct {
+			Notifications []string `yaml:"notifications"`
+		}
+		if err := decoder.Decode(&profile); errors.Is(err, io.EOF) {
+			return names, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("error parsing profiles.yaml: %w", err)
+		}
+		for _, name := range profile.Notifications {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+}
+
+// readCrowdsecNotifications returns the notification plugins in
+// config/crowdsec/notifications that a profile notifies. The crowdsec image
+// adds unused default configurations next to them.
+func readCrowdsecNotifications() ([]crowdsecNotification, error) {
+	used, err := readProfileNotifications()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(crowdsecNotificationsDir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	notifications := []crowdsecNotification{}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", file, err)
+		}
+		var notification crowdsecNotification
+		if err := yaml.Unmarshal(content, &notification); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", file, err)
+		}
+		if !slices.Contains(used, notification.Name) {
+			continue
+		}
+		notification.File = file
+		notifications = append(notifications, notification)
+	}
+	return notifications, nil
+}
+
+// runCrowdsecNotificationsCommand lists the notification plugins or sends
+// a test alert through them.
+func runCrowdsecNotificationsCommand(containerType SupportedContainer, args []string) error {
+	args, asJSON := cutJSONFlag(args)
+	notifications, err := readCrowdsecNotifications()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 || args[0] == "list" {
+		if asJSON {
+			return printJSON(notifications)
+		}
+		if len(notifications) == 0 {
+			fmt.Println("No notification plugins configured.")
+			return nil
+		}
+		fmt.Printf("  %-20s %-8s %s\n", "NAME", "TYPE", "FILE")
+		for _, n := range notifications {
+			fmt.Printf("  %-20s %-8s %s\n", n.Name, n.Type, n.File)
+		}
+		return nil
+	}
+
+	if args[0] != "test" {
+		return fmt.Errorf("unknown notifications command: %s", args[0])
+	}
+
+	names := args[1:]
+	if len(names) == 0 {
+		for _, n := range notifications {
+			names = append(names, n.Name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no notification plugins configured")
+	}
+
+	failed := 0
+	for _, name := range names {
+		if _, err := runCscli(containerType, "notifications", "test", name); err != nil {
+			failed++
+			fmt.Printf("  %-20s failed: %v\n", name, err)
+			continue
+		}
+		fmt.Printf("  %-20s sent\n", name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d notification(s) failed", failed)
+	}
+	return nil
+}
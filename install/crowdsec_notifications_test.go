@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestHostWebhookURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{
+			name: "remote host",
+			url:  "https://hooks.example.com/crowdsec",
+			want: "https://hooks.example.com/crowdsec",
+		},
+		{
+			name: "localhost",
+			url:  "http://localhost/crowdsec",
+			want: "http://host.docker.internal/crowdsec",
+		},
+		{
+			name: "loopback address with a port",
+			url:  "http://127.0.0.1:8080/hook?token=abc",
+			want: "http://host.docker.internal:8080/hook?token=abc",
+		},
+		{
+			name: "not a url",
+			url:  "http://[invalid",
+			want: "http://[invalid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hostWebhookURL(tt.url); got != tt.want {
+				t.Errorf("hostWebhookURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// bouncerPullTimeout bounds the wait for a rotated bouncer to use its key.
+	bouncerPullTimeout  = 2 * time.Minute
+	bouncerPollInterval = 5 * time.Second
+	// bouncerKeyEnvPrefix registers a bouncer when the crowdsec container
+	// starts. The rest of the variable name is the bouncer name.
+	bouncerKeyEnvPrefix = "BOUNCER_KEY_"
+)
+
+// rotatableBouncer is a bouncer the installer can hand a new key to.
+type rotatableBouncer struct {
+	// files hold the key and are restored when the rotation fails.
+	files []string
+	// setKey stores the key of the bouncer registered as name.
+	setKey func(name, key string) error
+	// reload applies the restored files, nil when the bouncer watches them.
+	reload func() error
+	// trigger makes the bouncer contact the LAPI, nil when it polls on its own.
+	trigger func(containerType SupportedContainer)
+}
+
+func rotatableBouncerFor(name string) (*rotatableBouncer, error) {
+	switch name {
+	case traefikBouncerName:
+		return &rotatableBouncer{
+			files:   []string{"config/traefik/dynamic_config.yml", "docker-compose.yml"},
+			setKey:  setTraefikBouncerKey,
+			trigger: triggerTraefikBouncer,
+		}, nil
+	case firewallBouncerName:
+		if _, err := os.Stat(firewallBouncerConfig); err != nil {
+			return nil, fmt.Errorf("the firewall bouncer is not installed on this host")
+		}
+		if os.Geteuid() != 0 {
+			return nil, fmt.Errorf("rotating the key of the firewall bouncer requires root")
+		}
+		return &rotatableBouncer{
+			files: []string{firewallBouncerConfig},
+			setKey: func(_, key string) error {
+				return setFirewallBouncerKey(key)
+			},
+			reload: restartFirewallBouncer,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown bouncer %q, expected %s or %s", name, traefikBouncerName, firewallBouncerName)
+}
+
+// isBouncerOf reports whether registered is a registration of the bouncer
+// name, either the original one or one created by a rotation.
+func isBouncerOf(registered, name string) bool {
+	if registered == name || strings.HasPrefix(registered, name+"_") {
+		return true
+	}
+	return name == traefikBouncerName && registered == legacyTraefikBouncerName
+}
+
+// rotateBouncer registers the bouncer under a new name with a new key, hands
+// the key to the bouncer and waits until the bouncer used it. Only then the
+// previous registrations are deleted, so the bouncer keeps working when the
+// rotation fails. The new name makes the rotation repeatable.
+func rotateBouncer(containerType SupportedContainer, name string) error {
+	bouncer, err := rotatableBouncerFor(name)
+	if err != nil {
+		return err
+	}
+
+	previous, err := listCrowdsecBouncers(containerType)
+	if err != nil {
+		return err
+	}
+
+	backups := map[string][]byte{}
+	for _, file := range bouncer.files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", file, err)
+		}
+		backups[file] = content
+	}
+
+	newName := name + "_" + time.Now().UTC().Format("20060102150405")
+	key := generateBouncerKey()
+	if _, err := runCscli(containerType, "bouncers", "add", newName, "-k", key); err != nil {
+		return err
+	}
+
+	started := time.Now()
+	err = bouncer.setKey(newName, key)
+	if err == nil {
+		fmt.Printf("Waiting for the %s bouncer to pull decisions with the new key...\n", name)
+		err = waitForBouncerPull(containerType, newName, started, bouncer.trigger)
+	}
+	if err != nil {
+		fmt.Println("Restoring the previous key...")
+		if restoreErr := restoreBouncerFiles(bouncer, backups); restoreErr != nil {
+			return fmt.Errorf("%v, restoring the previous key failed: %v", err, restoreErr)
+		}
+		if _, deleteErr := runCscli(containerType, "bouncers", "delete", newName); deleteErr != nil {
+			fmt.Printf("Warning: could not delete the bouncer %s: %v\n", newName, deleteErr)
+		}
+		return err
+	}
+
+	for _, registered := range previous {
+		if !isBouncerOf(registered.Name, name) {
+			continue
+		}
+		if _, err := runCscli(containerType, "bouncers", "delete", registered.Name); err != nil {
+			return fmt.Errorf("the new key works, but deleting the bouncer %s failed: %v", registered.Name, err)
+		}
+	}
+
+	fmt.Printf("Rotated the key of the %s bouncer, it is now registered as %s.\n", name, newName)
+	return nil
+}
+
+func restoreBouncerFiles(bouncer *rotatableBouncer, backups map[string][]byte) error {
+	for file, content := range backups {
+		if err := os.WriteFile(file, content, 0644); err != nil {
+			return fmt.Errorf("error writing %s: %w", file, err)
+		}
+	}
+	if bouncer.reload != nil {
+		return bouncer.reload()
+	}
+	return nil
+}
+
+// waitForBouncerPull waits until the bouncer registered as name pulled
+// decisions after since.
+func waitForBouncerPull(containerType SupportedContainer, name string, since time.Time, trigger func(SupportedContainer)) error {
+	deadline := time.Now().Add(bouncerPullTimeout)
+	for {
+		if trigger != nil {
+			trigger(containerType)
+		}
+
+		bouncers, err := listCrowdsecBouncers(containerType)
+		if err != nil {
+			return err
+		}
+		for _, bouncer := range bouncers {
+			if bouncer.Name == name && bouncer.LastPull != nil && !bouncer.LastPull.Before(since.Add(-time.Second)) {
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the bouncer %s did not pull decisions within %s", name, bouncerPullTimeout)
+		}
+		time.Sleep(bouncerPollInterval)
+	}
+}
+
+// setTraefikBouncerKey writes key into the CrowdSec middleware, which Traefik
+// reloads on its own. The crowdsec service registers the bouncer from
+// BOUNCER_KEY_<name>, so the variables of earlier registrations are replaced.
+func setTraefikBouncerKey(name, key string) error {
+	if err := updateYAMLFile("config/traefik/dynamic_config.yml", func(doc *yaml.Node) error {
+		plugin := lookupYAMLNode(doc, crowdsecPluginPath...)
+		if plugin == nil {
+			return fmt.Errorf("the CrowdSec middleware is missing from config/traefik/dynamic_config.yml")
+		}
+		return setYAMLValue(plugin, key, "crowdsecLapiKey")
+	}); err != nil {
+		return err
+	}
+
+	return updateYAMLFile("docker-compose.yml", func(doc *yaml.Node) error {
+		environment := lookupYAMLNode(doc, "services", "crowdsec", "environment")
+		if environment != nil && environment.Kind == yaml.MappingNode {
+			var content []*yaml.Node
+			for i := 0; i+1 < len(environment.Content); i += 2 {
+				variable := environment.Content[i].Value
+				if bouncer, ok := strings.CutPrefix(variable, bouncerKeyEnvPrefix); ok && isBouncerOf(bouncer, traefikBouncerName) {
+					continue
+				}
+				content = append(content, environment.Content[i], environment.Content[i+1])
+			}
+			environment.Content = content
+		}
+		return setYAMLValue(doc, key, "services", "crowdsec", "environment", bouncerKeyEnvPrefix+name)
+	})
+}
+
+// triggerTraefikBouncer sends a request for the dashboard through Traefik
+// from inside its container. The CrowdSec middleware checks the client with
+// the LAPI, which records the pull. Errors are ignored, the caller keeps
+// polling the LAPI.
+func triggerTraefikBouncer(containerType SupportedContainer) {
+	appConfig, err := ReadAppConfig("config/config.yml")
+	if err != nil {
+		return
+	}
+	dashboardURL, err := url.Parse(appConfig.DashboardURL)
+	if err != nil || dashboardURL.Hostname() == "" {
+		return
+	}
+	execInContainer(containerType, "traefik", "wget", "-q", "-O", "/dev/null", "--no-check-certificate",
+		"--header", "Host: "+dashboardURL.Hostname(), "https://127.0.0.1/")
+}
+
+// setFirewallBouncerKey writes key into the firewall bouncer configuration
+// and restarts the bouncer.
+func setFirewallBouncerKey(key string) error {
+	if err := updateYAMLFile(firewallBouncerConfig, func(doc *yaml.Node) error {
+		return setYAMLValue(doc, key, "api_key")
+	}); err != nil {
+		return err
+	}
+	return restartFirewallBouncer()
+}
+
+func restartFirewallBouncer() error {
+	if err := run("systemctl", "restart", firewallBouncerService); err != nil {
+		return fmt.Errorf("failed to restart %s: %v", firewallBouncerService, err)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestIsBouncerOf(t *testing.T) {
+	tests := []struct {
+		registered string
+		name       string
+		want       bool
+	}{
+		{registered: "traefik", name: "traefik", want: true},
+		{registered: "traefik_20260101120000", name: "traefik", want: true},
+		{registered: "traefik-bouncer", name: "traefik", want: true},
+		{registered: "traefikx", name: "traefik", want: false},
+		{registered: "traefik-other", name: "traefik", want: false},
+		{registered: "firewall", name: "traefik", want: false},
+		{registered: "firewall", name: "firewall", want: true},
+		{registered: "firewall_20260101120000", name: "firewall", want: true},
+		{registered: "firewall-bouncer", name: "firewall", want: false},
+		{registered: "traefik-bouncer", name: "firewall", want: false},
+		{registered: "cs-firewall-bouncer-1a2b", name: "firewall", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isBouncerOf(tt.registered, tt.name); got != tt.want {
+			t.Errorf("isBouncerOf(%q, %q) = %v, want %v", tt.registered, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DomainConfig is a single entry of the domains map in config.yml
+type DomainConfig struct {
+	Key                string `yaml:"-"`
+	BaseDomain         string `yaml:"base_domain"`
+	CertResolver       string `yaml:"cert_resolver,omitempty"`
+	PreferWildcardCert bool   `yaml:"prefer_wildcard_cert,omitempty"`
+}
+
+var domainLabelPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+func validateDomainName(domain string) error {
+	if strings.Contains(domain, "://") || strings.ContainsAny(domain, "/*: ") {
+		return fmt.Errorf("%q is not a valid domain: enter a bare domain like example.com", domain)
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("%q is not a valid domain: it needs at least two labels", domain)
+	}
+	for _, label := range labels {
+		if !domainLabelPattern.MatchString(label) {
+			return fmt.Errorf("%q is not a valid domain: invalid label %q", domain, label)
+		}
+	}
+	return nil
+}
+
+// validateDomain checks that a new base domain is well formed and that it
+// does not overlap with the configured ones, since a domain nested inside
+// another one would make Pangolin match resources against the wrong entry.
+func validateDomain(domain DomainConfig, existing []DomainConfig) error {
+	if err := validateDomainName(domain.BaseDomain); err != nil {
+		return err
+	}
+
+	for _, other := range existing {
+		switch {
+		case domain.BaseDomain == other.BaseDomain:
+			return fmt.Errorf("base domain %s is already configured", domain.BaseDomain)
+		case strings.HasSuffix(domain.BaseDomain, "."+other.BaseDomain):
+			return fmt.Errorf("base domain %s overlaps with %s", domain.BaseDomain, other.BaseDomain)
+		case strings.HasSuffix(other.BaseDomain, "."+domain.BaseDomain):
+			return fmt.Errorf("base domain %s overlaps with %s", other.BaseDomain, domain.BaseDomain)
+		}
+	}
+
+	if domain.PreferWildcardCert && domain.CertResolver == "" {
+		return fmt.Errorf("wildcard certificates for %s need the name of a DNS challenge certificate resolver", domain.BaseDomain)
+	}
+
+	return nil
+}
+
+// certResolverChallenge returns the ACME challenge of a certificate resolver
+// in the Traefik configuration. Before the first installation it reads the
+// configuration the installer is going to write. found is false when the
+// resolver is not configured.
+func certResolverChallenge(traefikConfigPath, name string) (challenge string, found bool, err error) {
+	content, err := os.ReadFile(traefikConfigPath)
+	if os.IsNotExist(err) {
+		rendered, renderErr := renderEmbeddedConfig("config/traefik/traefik_config.yml", Config{})
+		if renderErr != nil {
+			return "", false, renderErr
+		}
+		content = []byte(rendered)
+	} else if err != nil {
+		return "", false, fmt.Errorf("error reading traefik config: %w", err)
+	}
+
+	var traefikConfig struct {
+		CertificatesResolvers map[string]struct {
+			ACME struct {
+				DNSChallenge  *yaml.Node `yaml:"dnsChallenge"`
+				HTTPChallenge *yaml.Node `yaml:"httpChallenge"`
+				TLSChallenge  *yaml.Node `yaml:"tlsChallenge"`
+			} `yaml:"acme"`
+		} `yaml:"certificatesResolvers"`
+	}
+	if err := yaml.Unmarshal(content, &traefikConfig); err != nil {
+		return "", false, fmt.Errorf("error parsing traefik config: %w", err)
+	}
+
+	resolver, ok := traefikConfig.CertificatesResolvers[name]
+	if !ok {
+		return "", false, nil
+	}
+	switch {
+	case resolver.ACME.DNSChallenge != nil:
+		return "dnsChallenge", true, nil
+	case resolver.ACME.HTTPChallenge != nil:
+		return "httpChallenge", true, nil
+	case resolver.ACME.TLSChallenge != nil:
+		return "tlsChallenge", true, nil
+	}
+	return "", true, nil
+}
+
+// checkWildcardResolver warns when the resolver of a wildcard domain cannot
+// issue wildcard certificates. Only the DNS challenge can.
+func checkWildcardResolver(domain DomainConfig) {
+	const traefikConfigPath = "config/traefik/traefik_config.yml"
+
+	challenge, found, err := certResolverChallenge(traefikConfigPath, domain.CertResolver)
+	switch {
+	case err != nil:
+		fmt.Printf("Warning: could not check the %s certificate resolver: %v\n", domain.CertResolver, err)
+	case !found:
+		fmt.Printf("Remember to add the %s certificate resolver to %s.\n", domain.CertResolver, traefikConfigPath)
+	case challenge != "dnsChallenge":
+		fmt.Printf("Warning: the %s certificate resolver does not use the DNS challenge and cannot issue the wildcard certificate for %s.\n", domain.CertResolver, domain.BaseDomain)
+	}
+}
+
+// nextDomainKey returns the first free domainN key.
+func nextDomainKey(domains []DomainConfig) string {
+	for n := 1; ; n++ {
+		key := fmt.Sprintf("domain%d", n)
+		if !slices.ContainsFunc(domains, func(d DomainConfig) bool { return d.Key == key }) {
+			return key
+		}
+	}
+}
+
+// readDomain asks for a base domain and the certificate strategy to use for it.
+func readDomain(prompt string, existing []DomainConfig) DomainConfig {
+	for {
+		domain := DomainConfig{
+			Key:        nextDomainKey(existing),
+			BaseDomain: normalizeDomain(readString(prompt, "")),
+		}
+
+		fmt.Println("Certificates are issued per subdomain with the HTTP challenge by default.")
+		fmt.Println("Wildcard certificates need a Traefik certificate resolver that uses the DNS challenge.")
+		if readBool(fmt.Sprintf("Do you want to use a wildcard certificate for %s?", domain.BaseDomain), false) {
+			domain.PreferWildcardCert = true
+			domain.CertResolver = readString("Enter the name of the DNS challenge certificate resolver configured in Traefik", "")
+		}
+
+		if err := validateDomain(domain, existing); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+
+		if domain.PreferWildcardCert {
+			checkWildcardResolver(domain)
+		}
+
+		return domain
+	}
+}
+
+// collectDomainsInput asks for the primary base domain and any additional
+// base domains.
+func collectDomainsInput(config *Config) {
+	config.Domains = []DomainConfig{readDomain("Enter your base domain (no subdomain e.g. example.com)", nil)}
+	config.BaseDomain = config.Domains[0].BaseDomain
+
+	for readBool("Do you want to add another base domain?", false) {
+		config.Domains = append(config.Domains, readDomain("Enter the additional base domain", config.Domains))
+	}
+}
+
+// dnsPreflight checks that the dashboard domain and each base domain, as well
+// as a random subdomain below it, resolve. Failures are reported as warnings
+// because DNS changes can take a while to propagate.
+func dnsPreflight(dashboardDomain string, domains []DomainConfig) {
+	fmt.Println("\n=== DNS Preflight ===")
+
+	ok := true
+	check := func(name, label string) {
+		addrs, err := net.LookupHost(name)
+		if err != nil || len(addrs) == 0 {
+			fmt.Printf("Warning: %s (%s) does not resolve.\n", label, name)
+			ok = false
+			return
+		}
+		fmt.Printf("%s resolves to %s\n", label, strings.Join(addrs, ", "))
+	}
+
+	if dashboardDomain != "" {
+		check(dashboardDomain, "Dashboard domain")
+	}
+
+	for _, d := range domains {
+		check(d.BaseDomain, d.BaseDomain)
+
+		probe := make([]byte, 4)
+		if _, err := rand.Read(probe); err != nil {
+			continue
+		}
+		check(fmt.Sprintf("pangolin-%s.%s", hex.EncodeToString(probe), d.BaseDomain), "*."+d.BaseDomain)
+	}
+
+	if !ok {
+		fmt.Println("Point an A (and AAAA if IPv6 capable) record for each base domain and its wildcard (*.domain) to this server.")
+	}
+}
+
+// readConfiguredDomains returns the domains map of an existing config.yml.
+func readConfiguredDomains(configPath string) ([]DomainConfig, error) {
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing config file: %w", err)
+	}
+
+	var domains []DomainConfig
+	node := lookupYAMLNode(&doc, "domains")
+	if node == nil || node.Kind != yaml.MappingNode {
+		return domains, nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		var d DomainConfig
+		if err := node.Content[i+1].Decode(&d); err != nil {
+			return nil, fmt.Errorf("error parsing domain %s: %w", node.Content[i].Value, err)
+		}
+		d.Key = node.Content[i].Value
+		d.BaseDomain = normalizeDomain(d.BaseDomain)
+		domains = append(domains, d)
+	}
+
+	return domains, nil
+}
+
+// findRemovableDomain returns the configured domain with the given key or base
+// domain. The last domain cannot be removed.
+func findRemovableDomain(domains []DomainConfig, target string) (DomainConfig, error) {
+	target = normalizeDomain(target)
+	idx := slices.IndexFunc(domains, func(d DomainConfig) bool {
+		return d.Key == target || d.BaseDomain == target
+	})
+	if idx == -1 {
+		return DomainConfig{}, fmt.Errorf("domain %s is not configured", target)
+	}
+	if len(domains) == 1 {
+		return DomainConfig{}, fmt.Errorf("cannot remove %s: at least one domain must be configured", domains[idx].BaseDomain)
+	}
+	return domains[idx], nil
+}
+
+// writeDomain adds the domain to the domains map of config.yml.
+func writeDomain(configPath string, domain DomainConfig) error {
+	return updateYAMLFile(configPath, func(doc *yaml.Node) error {
+		return setYAMLValue(doc, domain, "domains", domain.Key)
+	})
+}
+
+// deleteDomain removes the entry with the given key from the domains map of
+// config.yml.
+func deleteDomain(configPath, key string) error {
+	return updateYAMLFile(configPath, func(doc *yaml.Node) error {
+		if !deleteYAMLValue(doc, "domains", key) {
+			return errYAMLUnchanged
+		}
+		return nil
+	})
+}
+
+func runDomainsCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: domains list | domains add | domains remove <base domain or key>")
+	}
+
+	if _, err := enterInstallDirectory(); err != nil {
+		return err
+	}
+
+	domains, err := readConfiguredDomains("config/config.yml")
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		if len(domains) == 0 {
+			fmt.Println("No domains are configured in config/config.yml.")
+			return nil
+		}
+		for _, d := range domains {
+			resolver := d.CertResolver
+			if resolver == "" {
+				resolver = "default"
+			}
+			fmt.Printf("%-10s %-30s resolver: %-12s wildcard: %t\n", d.Key, d.BaseDomain, resolver, d.PreferWildcardCert)
+		}
+		return nil
+
+	case "add":
+		domain := readDomain("Enter the base domain to add", domains)
+		if err := writeDomain("config/config.yml", domain); err != nil {
+			return err
+		}
+		fmt.Printf("Added %s as %s.\n", domain.BaseDomain, domain.Key)
+		dnsPreflight("", []DomainConfig{domain})
+
+	case "remove":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: domains remove <base domain or key>")
+		}
+		domain, err := findRemovableDomain(domains, args[1])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Resources using %s will no longer be reachable once Pangolin restarts.\n", domain.BaseDomain)
+		if !readBool(fmt.Sprintf("Remove %s?", domain.BaseDomain), false) {
+			return nil
+		}
+		if err := deleteDomain("config/config.yml", domain.Key); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s.\n", domain.BaseDomain)
+
+	default:
+		return fmt.Errorf("unknown domains command: %s", args[0])
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		fmt.Println("Restart the pangolin container to apply the change.")
+		return nil
+	}
+
+	if readBool("Would you like to restart Pangolin to apply the change?", true) {
+		return restartContainer("pangolin", containerType)
+	}
+
+	return nil
+}
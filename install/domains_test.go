@@ -0,0 +1,269 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateDomain(t *testing.T) {
+	existing := []DomainConfig{
+		{Key: "domain1", BaseDomain: "example.com"},
+		// Configured entries are not validated again
+		{Key: "domain2", BaseDomain: "wild.example.net", PreferWildcardCert: true, CertResolver: "letsencrypt"},
+	}
+
+	tests := []struct {
+		name    string
+		domain  DomainConfig
+		wantErr bool
+	}{
+		{
+			name:   "new domain",
+			domain: DomainConfig{BaseDomain: "example.org"},
+		},
+		{
+			name:   "wildcard with a resolver",
+			domain: DomainConfig{BaseDomain: "example.org", PreferWildcardCert: true, CertResolver: "letsencrypt"},
+		},
+		{
+			name:    "wildcard without a resolver",
+			domain:  DomainConfig{BaseDomain: "example.org", PreferWildcardCert: true},
+			wantErr: true,
+		},
+		{
+			name:    "already configured",
+			domain:  DomainConfig{BaseDomain: "example.com"},
+			wantErr: true,
+		},
+		{
+			name:    "inside a configured domain",
+			domain:  DomainConfig{BaseDomain: "sub.example.com"},
+			wantErr: true,
+		},
+		{
+			name:    "around a configured domain",
+			domain:  DomainConfig{BaseDomain: "example.net"},
+			wantErr: true,
+		},
+		{
+			name:   "shared suffix is not an overlap",
+			domain: DomainConfig{BaseDomain: "myexample.com"},
+		},
+		{
+			name:    "single label",
+			domain:  DomainConfig{BaseDomain: "localhost"},
+			wantErr: true,
+		},
+		{
+			name:    "url",
+			domain:  DomainConfig{BaseDomain: "https://example.org"},
+			wantErr: true,
+		},
+		{
+			name:    "wildcard name",
+			domain:  DomainConfig{BaseDomain: "*.example.org"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid label",
+			domain:  DomainConfig{BaseDomain: "-bad.example.org"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDomain(tt.domain, existing)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateDomain(%q) error = %v, wantErr %v", tt.domain.BaseDomain, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCertResolverChallenge(t *testing.T) {
+	traefikConfig := `certificatesResolvers:
+  letsencrypt:
+    acme:
+      dnsChallenge:
+        provider: cloudflare
+  http:
+    acme:
+      httpChallenge:
+        entryPoint: web
+  tls:
+    acme:
+      tlsChallenge: {}
+`
+	path := filepath.Join(t.TempDir(), "traefik_config.yml")
+	if err := os.WriteFile(path, []byte(traefikConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		path          string
+		resolver      string
+		wantChallenge string
+		wantFound     bool
+	}{
+		{
+			name:          "dns challenge named letsencrypt",
+			path:          path,
+			resolver:      "letsencrypt",
+			wantChallenge: "dnsChallenge",
+			wantFound:     true,
+		},
+		{
+			name:          "http challenge",
+			path:          path,
+			resolver:      "http",
+			wantChallenge: "httpChallenge",
+			wantFound:     true,
+		},
+		{
+			name:          "tls challenge",
+			path:          path,
+			resolver:      "tls",
+			wantChallenge: "tlsChallenge",
+			wantFound:     true,
+		},
+		{
+			name:     "missing resolver",
+			path:     path,
+			resolver: "cloudflare",
+		},
+		{
+			name:          "default configuration before the installation",
+			path:          filepath.Join(t.TempDir(), "missing.yml"),
+			resolver:      "letsencrypt",
+			wantChallenge: "httpChallenge",
+			wantFound:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			challenge, found, err := certResolverChallenge(tt.path, tt.resolver)
+			if err != nil {
+				t.Fatalf("certResolverChallenge() error = %v", err)
+			}
+			if challenge != tt.wantChallenge || found != tt.wantFound {
+				t.Errorf("certResolverChallenge() = %q, %t, want %q, %t", challenge, found, tt.wantChallenge, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestFindRemovableDomain(t *testing.T) {
+	domains := []DomainConfig{
+		{Key: "domain1", BaseDomain: "example.com"},
+		{Key: "domain2", BaseDomain: "example.org"},
+	}
+
+	tests := []struct {
+		name    string
+		domains []DomainConfig
+		target  string
+		want    DomainConfig
+		wantErr bool
+	}{
+		{
+			name:    "by key",
+			domains: domains,
+			target:  "domain2",
+			want:    domains[1],
+		},
+		{
+			name:    "by base domain",
+			domains: domains,
+			target:  "Example.ORG.",
+			want:    domains[1],
+		},
+		{
+			name:    "not configured",
+			domains: domains,
+			target:  "example.net",
+			wantErr: true,
+		},
+		{
+			name:    "last domain",
+			domains: domains[:1],
+			target:  "example.com",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findRemovableDomain(tt.domains, tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findRemovableDomain(%q) error = %v, wantErr %v", tt.target, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findRemovableDomain(%q) = %+v, want %+v", tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteAndDeleteDomain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	installed := `app:
+  dashboard_url: https://pangolin.example.com
+domains:
+  domain1:
+    base_domain: example.com
+    cert_resolver: letsencrypt
+`
+	if err := os.WriteFile(path, []byte(installed), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	domains, err := readConfiguredDomains(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added := DomainConfig{
+		Key:                nextDomainKey(domains),
+		BaseDomain:         "example.org",
+		CertResolver:       "dns",
+		PreferWildcardCert: true,
+	}
+	if err := writeDomain(path, added); err != nil {
+		t.Fatalf("writeDomain() error = %v", err)
+	}
+
+	domains, err = readConfiguredDomains(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DomainConfig{
+		{Key: "domain1", BaseDomain: "example.com", CertResolver: "letsencrypt"},
+		{Key: "domain2", BaseDomain: "example.org", CertResolver: "dns", PreferWildcardCert: true},
+	}
+	if !reflect.DeepEqual(domains, want) {
+		t.Fatalf("after writeDomain() = %+v, want %+v", domains, want)
+	}
+
+	if err := deleteDomain(path, "domain1"); err != nil {
+		t.Fatalf("deleteDomain() error = %v", err)
+	}
+	domains, err = readConfiguredDomains(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(domains, want[1:]) {
+		t.Errorf("after deleteDomain() = %+v, want %+v", domains, want[1:])
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decodeYAML(t, got).(map[string]any)["app"], map[string]any{"dashboard_url": "https://pangolin.example.com"}) {
+		t.Errorf("deleteDomain() changed other keys:\n%s", got)
+	}
+}
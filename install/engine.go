@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// engineAPIVersion is the Docker Engine API version requested from the daemon.
+// Podman implements the same compatibility API.
+const engineAPIVersion = "v1.41"
+
+// engineRequestTimeout bounds calls that are expected to return promptly.
+const engineRequestTimeout = 10 * time.Second
+
+// engineClient talks to the Docker Engine API exposed by Docker and by
+// Podman's API socket.
+type engineClient struct {
+	http    *http.Client
+	baseURL string
+}
+
+// ContainerInspect is the subset of the container inspect response the
+// installer uses.
+type ContainerInspect struct {
+	ID    string `json:"Id"`
+	Name  string `json:"Name"`
+	Image string `json:"Image"`
+	State struct {
+		Status   string        `json:"Status"`
+		Running  bool          `json:"Running"`
+		ExitCode int           `json:"ExitCode"`
+		Health   *HealthStatus `json:"Health"`
+	} `json:"State"`
+	Config struct {
+		Image       string         `json:"Image"`
+		Tty         bool           `json:"Tty"`
+		Labels      map[string]any `json:"Labels"`
+		Healthcheck *struct {
+			Test []string `json:"Test"`
+		} `json:"Healthcheck"`
+	} `json:"Config"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress         string `json:"IPAddress"`
+			GlobalIPv6Address string `json:"GlobalIPv6Address"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// HealthStatus is the healthcheck state of a container.
+type HealthStatus struct {
+	Status        string `json:"Status"`
+	FailingStreak int    `json:"FailingStreak"`
+	Log           []struct {
+		Start    string `json:"Start"`
+		End      string `json:"End"`
+		ExitCode int    `json:"ExitCode"`
+		Output   string `json:"Output"`
+	} `json:"Log"`
+}
+
+// ImageInspect is the subset of the image inspect response the installer uses.
+type ImageInspect struct {
+	ID          string   `json:"Id"`
+	RepoTags    []string `json:"RepoTags"`
+	RepoDigests []string `json:"RepoDigests"`
+}
+
+// ExecResult is the outcome of a command run inside a container.
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// errContainerNotFound is returned when the engine does not know the container.
+var errContainerNotFound = errors.New("container not found")
+
+// engineSocketAddress returns the API address for the container type. It
+// honours DOCKER_HOST for Docker and CONTAINER_HOST for Podman, and otherwise
+// uses the default socket locations.
+func engineSocketAddress(containerType SupportedContainer) string {
+	switch containerType {
+	case Docker:
+		if host := os.Getenv("DOCKER_HOST"); host != "" {
+			return host
+		}
+		return "unix:///var/run/docker.sock"
+	case Podman:
+		if host := os.Getenv("CONTAINER_HOST"); host != "" {
+			return host
+		}
+		if os.Geteuid() == 0 {
+			return "unix:///run/podman/podman.sock"
+		}
+		if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+			return "unix://" + filepath.Join(runtimeDir, "podman/podman.sock")
+		}
+		return fmt.Sprintf("unix:///run/user/%d/podman/podman.sock", os.Geteuid())
+	}
+	return ""
+}
+
+// newEngineClient connects to the API of the given container engine and
+// verifies it responds.
+func newEngineClient(containerType SupportedContainer) (*engineClient, error) {
+	address := engineSocketAddress(containerType)
+	if address == "" {
+		return nil, fmt.Errorf("unsupported container type: %s", containerType)
+	}
+	return dialEngine(address)
+}
+
+// dialEngine connects to the engine API at address, a unix://, tcp:// or
+// http(s):// URL, and verifies it responds.
+func dialEngine(address string) (*engineClient, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid engine address %s: %v", address, err)
+	}
+
+	transport := &http.Transport{}
+	client := &engineClient{http: &http.Client{Transport: transport}}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		client.baseURL = "http://engine"
+	case "tcp", "http", "https":
+		scheme := "http"
+		if u.Scheme == "https" || os.Getenv("DOCKER_TLS_VERIFY") != "" {
+			tlsConfig, err := engineTLSConfig()
+			if err != nil {
+				return nil, err
+			}
+			transport.TLSClientConfig = tlsConfig
+			scheme = "https"
+		}
+		client.baseURL = scheme + "://" + u.Host
+	default:
+		return nil, fmt.Errorf("unsupported engine address %s", address)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), engineRequestTimeout)
+	defer cancel()
+	if err := client.Ping(ctx); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// engineTLSConfig loads the client certificates from DOCKER_CERT_PATH the same
+// way the docker CLI does.
+func engineTLSConfig() (*tls.Config, error) {
+	certPath := os.Getenv("DOCKER_CERT_PATH")
+	if certPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("error getting home directory: %v", err)
+		}
+		certPath = filepath.Join(home, ".docker")
+	}
+
+	cert, err := tls.LoadX509KeyPair(filepath.Join(certPath, "cert.pem"), filepath.Join(certPath, "key.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load engine client certificate: %v", err)
+	}
+
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if ca, err := os.ReadFile(filepath.Join(certPath, "ca.pem")); err == nil {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+func (c *engineClient) do(ctx context.Context, method, path string, query url.Values, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	target := c.baseURL + "/" + engineAPIVersion + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("engine request %s %s failed: %w", method, path, err)
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		// Only a missing container is reported as errContainerNotFound, a
+		// missing image or network keeps the message of the engine
+		if container, ok := strings.CutPrefix(path, "/containers/"); ok && resp.StatusCode == http.StatusNotFound && container != "json" {
+			container, _, _ = strings.Cut(container, "/")
+			if name, err := url.PathUnescape(container); err == nil {
+				container = name
+			}
+			return nil, fmt.Errorf("%w: %s", errContainerNotFound, container)
+		}
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+			return nil, fmt.Errorf("engine request %s %s failed: %s", method, path, apiErr.Message)
+		}
+		return nil, fmt.Errorf("engine request %s %s failed with status %d", method, path, resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+// Ping checks that the engine answers API requests.
+func (c *engineClient) Ping(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodGet, "/_ping", nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// InspectContainer returns the state of a container.
+func (c *engineClient) InspectContainer(ctx context.Context, name string) (*ContainerInspect, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(name)+"/json", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var inspect ContainerInspect
+	if err := json.NewDecoder(resp.Body).Decode(&inspect); err != nil {
+		return nil, fmt.Errorf("failed to decode inspect response for %s: %v", name, err)
+	}
+	return &inspect, nil
+}
+
+// InspectImage returns the inspect data of an image.
+func (c *engineClient) InspectImage(ctx context.Context, name string) (*ImageInspect, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/images/"+name+"/json", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var inspect ImageInspect
+	if err := json.NewDecoder(resp.Body).Decode(&inspect); err != nil {
+		return nil, fmt.Errorf("failed to decode image inspect response for %s: %v", name, err)
+	}
+	return &inspect, nil
+}
+
+// ListContainers returns the IDs of the containers, only running ones unless
+// all is set.
+func (c *engineClient) ListContainers(ctx context.Context, all bool) ([]string, error) {
+	query := url.Values{}
+	if all {
+		query.Set("all", "true")
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, "/containers/json", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var containers []struct {
+		ID string `json:"Id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("failed to decode container list: %v", err)
+	}
+
+	ids := make([]string, 0, len(containers))
+	for _, container := range containers {
+		ids = append(ids, container.ID)
+	}
+	return ids, nil
+}
+
+// StreamLogs copies the logs of a container to stdout and stderr. tail limits
+// the output to the last lines ("all" for everything) and follow keeps
+// streaming until ctx is cancelled.
+func (c *engineClient) StreamLogs(ctx context.Context, name, tail string, follow bool, stdout, stderr io.Writer) error {
+	// The logs of containers without a TTY are multiplexed. The Content-Type
+	// does not tell, API versions before 1.42 label both forms as raw-stream.
+	inspect, err := c.InspectContainer(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("stdout", "true")
+	query.Set("stderr", "true")
+	query.Set("tail", tail)
+	if follow {
+		query.Set("follow", "true")
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(name)+"/logs", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if inspect.Config.Tty {
+		_, err = io.Copy(stdout, resp.Body)
+	} else {
+		err = demuxStream(resp.Body, stdout, stderr)
+	}
+	if err != nil && ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// Exec runs a command in a running container and waits for it to finish.
+func (c *engineClient) Exec(ctx context.Context, name string, cmd ...string) (*ExecResult, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(name)+"/exec", nil, map[string]any{
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Cmd":          cmd,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode exec response: %v", err)
+	}
+
+	resp, err = c.do(ctx, http.MethodPost, "/exec/"+created.ID+"/start", nil, map[string]any{"Detach": false, "Tty": false})
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	err = demuxStream(resp.Body, &stdout, &stderr)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exec output: %v", err)
+	}
+
+	resp, err = c.do(ctx, http.MethodGet, "/exec/"+created.ID+"/json", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var state struct {
+		ExitCode int `json:"ExitCode"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to decode exec state: %v", err)
+	}
+
+	return &ExecResult{Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: state.ExitCode}, nil
+}
+
+// demuxStream splits the multiplexed stdout/stderr stream the engine returns
+// for containers without a TTY. Each frame starts with an 8 byte header: the
+// stream type followed by the big endian payload size.
+func demuxStream(r io.Reader, stdout, stderr io.Writer) error {
+	reader := bufio.NewReader(r)
+	header := make([]byte, 8)
+
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		dst := stdout
+		if header[0] == 2 {
+			dst = stderr
+		}
+		if _, err := io.CopyN(dst, reader, size); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// frame builds one frame of a multiplexed engine stream.
+func frame(stream byte, payload string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func TestDemuxStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      []byte
+		wantStdout string
+		wantStderr string
+		wantErr    bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:       "stdout only",
+			input:      frame(1, "hello\n"),
+			wantStdout: "hello\n",
+		},
+		{
+			name:       "interleaved",
+			input:      bytes.Join([][]byte{frame(1, "out 1\n"), frame(2, "err 1\n"), frame(1, "out 2\n")}, nil),
+			wantStdout: "out 1\nout 2\n",
+			wantStderr: "err 1\n",
+		},
+		{
+			name:       "empty frame",
+			input:      append(frame(1, ""), frame(2, "err\n")...),
+			wantStderr: "err\n",
+		},
+		{
+			name:    "truncated header",
+			input:   frame(1, "ok")[:5],
+			wantErr: true,
+		},
+		{
+			name:       "truncated payload",
+			input:      frame(1, "hello")[:10],
+			wantStdout: "he",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			err := demuxStream(bytes.NewReader(tt.input), &stdout, &stderr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("demuxStream() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if stdout.String() != tt.wantStdout {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.wantStdout)
+			}
+			if stderr.String() != tt.wantStderr {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
+
+// fakeEngine serves the container inspect and logs endpoints for one
+// container. Like the engine at API 1.41, it labels the logs as a raw stream
+// whether they are multiplexed or not.
+func fakeEngine(t *testing.T, tty bool, logs []byte) *engineClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + engineAPIVersion + "/_ping":
+			w.Write([]byte("OK"))
+		case "/" + engineAPIVersion + "/containers/pangolin/json":
+			w.Header().Set("Content-Type", "application/json")
+			if tty {
+				w.Write([]byte(`{"Id":"1","Config":{"Tty":true}}`))
+			} else {
+				w.Write([]byte(`{"Id":"1","Config":{"Tty":false}}`))
+			}
+		case "/" + engineAPIVersion + "/containers/pangolin/logs":
+			w.Header().Set("Content-Type", "application/vnd.docker.raw-stream")
+			w.Write(logs)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"No such object: ` + strings.TrimPrefix(r.URL.Path, "/"+engineAPIVersion) + `"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := dialEngine(server.URL)
+	if err != nil {
+		t.Fatalf("dialEngine() error = %v", err)
+	}
+	return client
+}
+
+func TestStreamLogs(t *testing.T) {
+	tests := []struct {
+		name       string
+		tty        bool
+		logs       []byte
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "multiplexed",
+			logs:       append(frame(1, "setup token: abc\n"), frame(2, "warning\n")...),
+			wantStdout: "setup token: abc\n",
+			wantStderr: "warning\n",
+		},
+		{
+			name:       "tty",
+			tty:        true,
+			logs:       []byte("setup token: abc\n"),
+			wantStdout: "setup token: abc\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fakeEngine(t, tt.tty, tt.logs)
+			var stdout, stderr bytes.Buffer
+			if err := client.StreamLogs(context.Background(), "pangolin", "all", false, &stdout, &stderr); err != nil {
+				t.Fatalf("StreamLogs() error = %v", err)
+			}
+			if stdout.String() != tt.wantStdout {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.wantStdout)
+			}
+			if stderr.String() != tt.wantStderr {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestEngineNotFound(t *testing.T) {
+	client := fakeEngine(t, false, nil)
+	ctx := context.Background()
+
+	_, err := client.InspectContainer(ctx, "gerbil")
+	if !errors.Is(err, errContainerNotFound) || !strings.Contains(err.Error(), "gerbil") {
+		t.Errorf("InspectContainer() error = %v, want errContainerNotFound naming gerbil", err)
+	}
+
+	_, err = client.InspectImage(ctx, "fosrl/pangolin:latest")
+	if err == nil || errors.Is(err, errContainerNotFound) || !strings.Contains(err.Error(), "fosrl/pangolin:latest") {
+		t.Errorf("InspectImage() error = %v, want an error naming the image", err)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// firewallBouncerName is the name the host firewall bouncer is registered
+	// with in CrowdSec.
+	firewallBouncerName    = "firewall"
+	firewallBouncerService = "crowdsec-firewall-bouncer"
+	firewallBouncerConfig  = "/etc/crowdsec/bouncers/crowdsec-firewall-bouncer.yaml"
+	// crowdsecLAPIAddress is where the crowdsec service publishes its LAPI
+	// for the firewall bouncer. It is only reachable from the host.
+	crowdsecLAPIAddress = "127.0.0.1:8080"
+	// crowdsecPackageRepository hosts the deb and rpm packages of CrowdSec.
+	crowdsecPackageRepository = "https://packagecloud.io/crowdsec/crowdsec"
+)
+
+// readFirewallBouncerChoice asks whether banned IPs should also be blocked by
+// the host firewall.
+func readFirewallBouncerChoice() bool {
+	if activeBundle != nil {
+		// The bouncer is installed from the CrowdSec package repository
+		return false
+	}
+	fmt.Println("CrowdSec blocks banned IPs in Traefik only. The firewall bouncer also blocks them on the host, including the WireGuard ports of Gerbil and SSH. It is installed from the CrowdSec package repository.")
+	return readBool("Would you like to install the CrowdSec firewall bouncer on the host?", false)
+}
+
+// firewallBouncerMode returns the firewall backend of the host.
+func firewallBouncerMode() string {
+	if _, err := exec.LookPath("nft"); err == nil {
+		return "nftables"
+	}
+	return "iptables"
+}
+
+// installFirewallBouncer installs the firewall bouncer package, registers
+// it with CrowdSec and points it at the LAPI published on the host. CrowdSec
+// must be running.
+func installFirewallBouncer(config Config) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("installing the firewall bouncer requires root")
+	}
+
+	mode := firewallBouncerMode()
+	fmt.Printf("Installing the CrowdSec firewall bouncer for %s...\n", mode)
+	if err := installFirewallBouncerPackage(mode); err != nil {
+		return fmt.Errorf("failed to install the firewall bouncer: %v", err)
+	}
+
+	if err := ensureBouncer(config.InstallationContainerType, firewallBouncerName, config.FirewallBouncerKey); err != nil {
+		return fmt.Errorf("failed to register the firewall bouncer: %v", err)
+	}
+
+	if err := configureFirewallBouncer(config.InstallationContainerType, mode, config.FirewallBouncerKey); err != nil {
+		return err
+	}
+
+	if err := run("systemctl", "enable", firewallBouncerService); err != nil {
+		return fmt.Errorf("failed to enable %s: %v", firewallBouncerService, err)
+	}
+	if err := run("systemctl", "restart", firewallBouncerService); err != nil {
+		return fmt.Errorf("failed to start %s: %v", firewallBouncerService, err)
+	}
+
+	fmt.Println("The CrowdSec firewall bouncer is running.")
+	return nil
+}
+
+// installFirewallBouncerPackage adds the CrowdSec package repository with its
+// signing key and installs the bouncer for mode.
+func installFirewallBouncerPackage(mode string) error {
+	content, err := os.ReadFile("/etc/os-release")
+	if err != nil {
+		return fmt.Errorf("failed to detect Linux distribution: %v", err)
+	}
+	osRelease := string(content)
+	id, version := osReleaseValue(osRelease, "ID"), osReleaseValue(osRelease, "VERSION_ID")
+	major, _, _ := strings.Cut(version, ".")
+
+	pkg := "crowdsec-firewall-bouncer-" + mode
+
+	// rpmRepo is the path of the rpm repository for the distribution
+	var rpmRepo string
+	switch id {
+	case "ubuntu", "debian":
+		installCmd := exec.Command("bash", "-c", fmt.Sprintf(`
+			apt-get update &&
+			apt-get install -y ca-certificates curl gpg &&
+			mkdir -p /etc/apt/keyrings &&
+			curl -fsSL %s/gpgkey | gpg --dearmor --yes -o /etc/apt/keyrings/crowdsec-archive-keyring.gpg &&
+			echo "deb [signed-by=/etc/apt/keyrings/crowdsec-archive-keyring.gpg] %s/any any main" > /etc/apt/sources.list.d/crowdsec.list &&
+			apt-get update &&
+			apt-get install -y %s
+		`, crowdsecPackageRepository, crowdsecPackageRepository, pkg))
+		installCmd.Stdout = os.Stdout
+		installCmd.Stderr = os.Stderr
+		return installCmd.Run()
+	case "fedora":
+		rpmRepo = "fedora/" + version
+	case "rhel", "almalinux", "rocky":
+		rpmRepo = "el/" + major
+	case "amzn":
+		// Amazon Linux 2 is built from RHEL 7, Amazon Linux 2023 is close to RHEL 9
+		rpmRepo = "el/7"
+		if major != "2" {
+			rpmRepo = "el/9"
+		}
+	default:
+		return fmt.Errorf("unsupported Linux distribution, install %s manually", pkg)
+	}
+
+	repo := fmt.Sprintf(`[crowdsec]
+name=CrowdSec
+baseurl=%s/%s/$basearch
+repo_gpgcheck=1
+gpgcheck=1
+enabled=1
+gpgkey=%s/gpgkey
+sslverify=1
+metadata_expire=300
+`, crowdsecPackageRepository, rpmRepo, crowdsecPackageRepository)
+	if err := os.WriteFile("/etc/yum.repos.d/crowdsec.repo", []byte(repo), 0644); err != nil {
+		return fmt.Errorf("failed to add the CrowdSec repository: %v", err)
+	}
+
+	// Amazon Linux 2 only has yum
+	packageManager := "dnf"
+	if !commandExists("dnf") {
+		packageManager = "yum"
+	}
+	return run(packageManager, "install", "-y", pkg)
+}
+
+// osReleaseValue returns the value of key in the contents of /etc/os-release.
+func osReleaseValue(osRelease, key string) string {
+	for _, line := range strings.Split(osRelease, "\n") {
+		if value, ok := strings.CutPrefix(line, key+"="); ok {
+			return strings.Trim(value, `"'`)
+		}
+	}
+	return ""
+}
+
+// configureFirewallBouncer writes the LAPI address and key into the bouncer
+// configuration. Published container ports bypass the INPUT chain, so the
+// bouncer also filters forwarded traffic.
+func configureFirewallBouncer(containerType SupportedContainer, mode, key string) error {
+	hookKey, hooks := "nftables_hooks", []string{"input", "forward"}
+	if mode == "iptables" {
+		hookKey, hooks = "iptables_chains", []string{"INPUT", "FORWARD"}
+		if containerType == Docker {
+			// Docker evaluates DOCKER-USER before its own forwarding rules
+			hooks[1] = "DOCKER-USER"
+		}
+	}
+
+	return updateYAMLFile(firewallBouncerConfig, func(doc *yaml.Node) error {
+		if err := setYAMLValue(doc, mode, "mode"); err != nil {
+			return err
+		}
+		if err := setYAMLValue(doc, "http://"+crowdsecLAPIAddress+"/", "api_url"); err != nil {
+			return err
+		}
+		if err := setYAMLValue(doc, key, "api_key"); err != nil {
+			return err
+		}
+		return setYAMLValue(doc, hooks, hookKey)
+	})
+}
+
+// removeFirewallBouncer stops the firewall bouncer and uninstalls its
+// package. It is a no-op when the bouncer was never installed.
+func removeFirewallBouncer() error {
+	if _, err := os.Stat(firewallBouncerConfig); os.IsNotExist(err) {
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("removing the firewall bouncer requires root")
+	}
+
+	if err := run("systemctl", "disable", "--now", firewallBouncerService); err != nil {
+		return fmt.Errorf("failed to stop %s: %v", firewallBouncerService, err)
+	}
+
+	mode := firewallBouncerMode()
+	if content, err := os.ReadFile(firewallBouncerConfig); err == nil {
+		var bouncerConfig struct {
+			Mode string `yaml:"mode"`
+		}
+		if yaml.Unmarshal(content, &bouncerConfig) == nil && bouncerConfig.Mode != "" {
+			mode = bouncerConfig.Mode
+		}
+	}
+
+	pkg := "crowdsec-firewall-bouncer-" + mode
+	switch {
+	case commandExists("apt-get"):
+		return run("apt-get", "remove", "-y", pkg)
+	case commandExists("dnf"):
+		return run("dnf", "remove", "-y", pkg)
+	case commandExists("yum"):
+		return run("yum", "remove", "-y", pkg)
+	}
+	return fmt.Errorf("%s was stopped, uninstall %s manually", firewallBouncerService, pkg)
+}
+
+func commandExists(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
@@ -85,6 +85,34 @@ func readString(prompt string, defaultValue string) string {
 	return value
 }
 
+// readOptionalString prompts for a value that may be left empty.
+func readOptionalString(prompt string, defaultValue string) string {
+	var value string
+
+	title := fmt.Sprintf("%s (optional)", prompt)
+	if defaultValue != "" {
+		title = fmt.Sprintf("%s (default: %s)", prompt, defaultValue)
+	}
+
+	input := huh.NewInput().
+		Title(title).
+		Value(&value)
+
+	err := runField(input)
+	handleAbort(err)
+
+	if value == "" {
+		value = defaultValue
+	}
+
+	// Print the answer so it remains visible in terminal history (skip in accessible mode as it already shows)
+	if !isAccessibleMode() {
+		fmt.Printf("%s: %s\n", prompt, value)
+	}
+
+	return value
+}
+
 func readPassword(prompt string) string {
 	var value string
 
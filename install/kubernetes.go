@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The Helm chart is the single source for both output modes: it is copied
+// as is for Helm, and rendered by the installer for plain manifests.
+//
+//go:embed kubernetes
+var kubernetesFiles embed.FS
+
+const (
+	outputCompose    = "compose"
+	outputKubernetes = "kubernetes"
+	outputHelm       = "helm"
+
+	kubernetesExposeHostNetwork  = "hostNetwork"
+	kubernetesExposeLoadBalancer = "loadBalancer"
+)
+
+// outputFlag selects what the installer produces: a compose installation or
+// a Kubernetes bundle.
+var outputFlag string
+
+// kubernetesValues are the values of the Helm chart. They are marshalled into
+// values.yaml and, for plain manifests, passed to the chart templates.
+type kubernetesValues struct {
+	Expose       string `yaml:"expose"`
+	StorageClass string `yaml:"storageClass"`
+	Pangolin     struct {
+		Image         string `yaml:"image"`
+		Secret        string `yaml:"secret"`
+		Config        string `yaml:"config"`
+		PrivateConfig string `yaml:"privateConfig"`
+		DBSize        string `yaml:"dbSize"`
+		Geoblocking   bool   `yaml:"geoblocking"`
+		GeoliteImage  string `yaml:"geoliteImage"`
+	} `yaml:"pangolin"`
+	Email struct {
+		Enabled  bool   `yaml:"enabled"`
+		SMTPUser string `yaml:"smtpUser"`
+		SMTPPass string `yaml:"smtpPass"`
+	} `yaml:"email"`
+	Gerbil struct {
+		Enabled    bool   `yaml:"enabled"`
+		Image      string `yaml:"image"`
+		ConfigSize string `yaml:"configSize"`
+	} `yaml:"gerbil"`
+	Traefik struct {
+		Image           string `yaml:"image"`
+		StaticConfig    string `yaml:"staticConfig"`
+		DynamicConfig   string `yaml:"dynamicConfig"`
+		LetsencryptSize string `yaml:"letsencryptSize"`
+		HTTPPort        int    `yaml:"httpPort"`
+		HTTPSPort       int    `yaml:"httpsPort"`
+	} `yaml:"traefik"`
+	Redis struct {
+		Enabled  bool   `yaml:"enabled"`
+		Image    string `yaml:"image"`
+		Password string `yaml:"password"`
+		DataSize string `yaml:"dataSize"`
+	} `yaml:"redis"`
+}
+
+// kubernetesKinds maps the kinds the chart emits to their API version, used to
+// validate the rendered manifests offline.
+var kubernetesKinds = map[string]string{
+	"Namespace":             "v1",
+	"Service":               "v1",
+	"ConfigMap":             "v1",
+	"Secret":                "v1",
+	"PersistentVolumeClaim": "v1",
+	"Deployment":            "apps/v1",
+	"StatefulSet":           "apps/v1",
+}
+
+func validateOutputFlag(output string) error {
+	switch output {
+	case outputCompose, outputKubernetes, outputHelm:
+		return nil
+	}
+	return fmt.Errorf("unknown output %q. Valid options are '%s', '%s' or '%s'", output, outputCompose, outputKubernetes, outputHelm)
+}
+
+// collectKubernetesInput asks for the cluster specific settings of the bundle.
+func collectKubernetesInput(config *Config) {
+	fmt.Println("\n=== Kubernetes Configuration ===")
+
+	config.KubernetesNamespace = readString("Enter the namespace to deploy Pangolin into", "pangolin")
+	fmt.Println("With host networking Traefik and Gerbil bind the ports of the node directly, which suits single node clusters like k3s.")
+	config.KubernetesHostNetwork = readBool("Do you want to expose Pangolin with host networking instead of a LoadBalancer service?", true)
+	config.KubernetesStorageClass = readOptionalString("Enter the storage class for the persistent volumes (leave empty for the cluster default)", "")
+}
+
+// renderEmbeddedConfig renders one of the embedded config templates into memory.
+func renderEmbeddedConfig(path string, config Config) (string, error) {
+	content, err := configFiles.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	tmpl, err := template.New(filepath.Base(path)).Funcs(imageFuncs).Parse(string(content))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template %s: %v", path, err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, config); err != nil {
+		return "", fmt.Errorf("failed to execute template %s: %v", path, err)
+	}
+	return out.String(), nil
+}
+
+// buildKubernetesValues renders the Pangolin and Traefik configuration from
+// config and collects everything the chart needs.
+func buildKubernetesValues(config Config) (kubernetesValues, error) {
+	var values kubernetesValues
+
+	values.Expose = kubernetesExposeLoadBalancer
+	if config.KubernetesHostNetwork {
+		values.Expose = kubernetesExposeHostNetwork
+	}
+	values.StorageClass = config.KubernetesStorageClass
+
+	// Secrets are passed through the environment, so they are left out of the
+	// config.yml that ends up in a ConfigMap.
+	public := config
+	public.Secret = ""
+	public.EmailSMTPUser = ""
+	public.EmailSMTPPass = ""
+
+	appConfig, err := renderEmbeddedConfig("config/config.yml", public)
+	if err != nil {
+		return values, err
+	}
+	staticConfig, err := renderEmbeddedConfig("config/traefik/traefik_config.yml", public)
+	if err != nil {
+		return values, err
+	}
+	dynamicConfig, err := renderEmbeddedConfig("config/traefik/dynamic_config.yml", public)
+	if err != nil {
+		return values, err
+	}
+
+	edition := ""
+	if config.IsEnterprise {
+		edition = "ee-"
+		if values.Pangolin.PrivateConfig, err = renderEmbeddedConfig("config/privateConfig.yml", config); err != nil {
+			return values, err
+		}
+	}
+
+	values.Pangolin.Image = rewriteImageRepository("docker.io/fosrl/pangolin") + ":" + edition + config.PangolinVersion
+	values.Pangolin.Secret = config.Secret
+	values.Pangolin.Config = appConfig
+	values.Pangolin.DBSize = "1Gi"
+	values.Pangolin.Geoblocking = config.EnableGeoblocking
+	values.Pangolin.GeoliteImage = rewriteImageRepository("docker.io/curlimages/curl") + ":latest"
+
+	values.Email.Enabled = config.EnableEmail
+	values.Email.SMTPUser = config.EmailSMTPUser
+	values.Email.SMTPPass = config.EmailSMTPPass
+
+	values.Gerbil.Enabled = config.InstallGerbil
+	values.Gerbil.Image = rewriteImageRepository("docker.io/fosrl/gerbil") + ":" + config.GerbilVersion
+	values.Gerbil.ConfigSize = "64Mi"
+
+	values.Traefik.Image = rewriteImageRepository("docker.io/traefik") + ":v3.6"
+	values.Traefik.StaticConfig = staticConfig
+	values.Traefik.DynamicConfig = dynamicConfig
+	values.Traefik.LetsencryptSize = "128Mi"
+	values.Traefik.HTTPPort = config.HTTPPort
+	values.Traefik.HTTPSPort = config.HTTPSPort
+
+	values.Redis.Enabled = config.InstallRedis
+	values.Redis.Image = rewriteImageRepository("docker.io/redis") + ":7-alpine"
+	values.Redis.Password = config.RedisPassword
+	values.Redis.DataSize = "1Gi"
+
+	return values, nil
+}
+
+// helmFuncs implements the subset of the Helm template functions the chart
+// uses, so the installer can render it without Helm.
+var helmFuncs = template.FuncMap{
+	"quote": func(v any) string {
+		return strconv.Quote(fmt.Sprint(v))
+	},
+	"b64enc": func(v string) string {
+		return base64.StdEncoding.EncodeToString([]byte(v))
+	},
+	"indent": func(spaces int, v string) string {
+		pad := strings.Repeat(" ", spaces)
+		return pad + strings.ReplaceAll(v, "\n", "\n"+pad)
+	},
+	"nindent": func(spaces int, v string) string {
+		pad := strings.Repeat(" ", spaces)
+		return "\n" + pad + strings.ReplaceAll(v, "\n", "\n"+pad)
+	},
+}
+
+// renderKubernetesManifests renders the chart templates with values the same
+// way `helm template` would and returns a multi document YAML stream.
+func renderKubernetesManifests(values kubernetesValues, namespace string) ([]byte, error) {
+	// Templates address values by their keys in values.yaml
+	raw, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal values: %v", err)
+	}
+	var valuesMap map[string]any
+	if err := yaml.Unmarshal(raw, &valuesMap); err != nil {
+		return nil, fmt.Errorf("failed to decode values: %v", err)
+	}
+
+	data := map[string]any{
+		"Values":  valuesMap,
+		"Release": map[string]any{"Name": "pangolin", "Namespace": namespace},
+	}
+
+	paths, err := fs.Glob(kubernetesFiles, "kubernetes/templates/*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var docs []string
+	docs = append(docs, fmt.Sprintf("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: %s\n", namespace))
+
+	for _, path := range paths {
+		content, err := kubernetesFiles.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+
+		tmpl, err := template.New(filepath.Base(path)).Funcs(helmFuncs).Option("missingkey=error").Parse(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %s: %v", path, err)
+		}
+
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			return nil, fmt.Errorf("failed to execute template %s: %v", path, err)
+		}
+
+		for _, doc := range strings.Split(out.String(), "\n---\n") {
+			doc = strings.TrimPrefix(strings.TrimSpace(doc), "---")
+			if strings.TrimSpace(doc) == "" {
+				continue
+			}
+			docs = append(docs, fmt.Sprintf("# Source: pangolin/templates/%s\n%s\n", filepath.Base(path), strings.TrimSpace(doc)))
+		}
+	}
+
+	return []byte(strings.Join(docs, "---\n")), nil
+}
+
+// validateKubernetesManifests checks the rendered manifests offline: every
+// document must be valid YAML of a known kind and API version, carry a name
+// and namespace, and every workload needs containers with an image.
+func validateKubernetesManifests(manifests []byte) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(manifests))
+
+	for i := 1; ; i++ {
+		var doc struct {
+			APIVersion string `yaml:"apiVersion"`
+			Kind       string `yaml:"kind"`
+			Metadata   struct {
+				Name      string `yaml:"name"`
+				Namespace string `yaml:"namespace"`
+			} `yaml:"metadata"`
+			Data map[string]string `yaml:"data"`
+			Spec struct {
+				Selector struct {
+					MatchLabels map[string]string `yaml:"matchLabels"`
+				} `yaml:"selector"`
+				Template struct {
+					Metadata struct {
+						Labels map[string]string `yaml:"labels"`
+					} `yaml:"metadata"`
+					Spec struct {
+						Containers []struct {
+							Name  string `yaml:"name"`
+							Image string `yaml:"image"`
+						} `yaml:"containers"`
+					} `yaml:"spec"`
+				} `yaml:"template"`
+			} `yaml:"spec"`
+		}
+
+		err := decoder.Decode(&doc)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("document %d is not valid YAML: %v", i, err)
+		}
+
+		apiVersion, ok := kubernetesKinds[doc.Kind]
+		if !ok {
+			return fmt.Errorf("document %d has an unknown kind %q", i, doc.Kind)
+		}
+		if doc.APIVersion != apiVersion {
+			return fmt.Errorf("%s in document %d must use apiVersion %s, not %q", doc.Kind, i, apiVersion, doc.APIVersion)
+		}
+		if doc.Metadata.Name == "" {
+			return fmt.Errorf("%s in document %d has no name", doc.Kind, i)
+		}
+		if doc.Kind != "Namespace" && doc.Metadata.Namespace == "" {
+			return fmt.Errorf("%s %s has no namespace", doc.Kind, doc.Metadata.Name)
+		}
+
+		// The embedded configuration files must survive the round trip
+		if doc.Kind == "ConfigMap" {
+			for key, value := range doc.Data {
+				var parsed any
+				if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+					return fmt.Errorf("%s in ConfigMap %s is not valid YAML: %v", key, doc.Metadata.Name, err)
+				}
+			}
+		}
+
+		if doc.Kind == "Deployment" || doc.Kind == "StatefulSet" {
+			if len(doc.Spec.Template.Spec.Containers) == 0 {
+				return fmt.Errorf("%s %s has no containers", doc.Kind, doc.Metadata.Name)
+			}
+			for _, c := range doc.Spec.Template.Spec.Containers {
+				if c.Name == "" || c.Image == "" || strings.HasSuffix(c.Image, ":") {
+					return fmt.Errorf("%s %s has a container without a name or a complete image", doc.Kind, doc.Metadata.Name)
+				}
+			}
+			for key, value := range doc.Spec.Selector.MatchLabels {
+				if doc.Spec.Template.Metadata.Labels[key] != value {
+					return fmt.Errorf("the selector of %s %s does not match its pod labels", doc.Kind, doc.Metadata.Name)
+				}
+			}
+		}
+	}
+}
+
+// writeKubernetesBundle renders the Kubernetes bundle for config, either as
+// plain manifests in kubernetes/pangolin.yaml or as a Helm chart in
+// helm/pangolin.
+func writeKubernetesBundle(config Config, output string) error {
+	if config.Branding != nil {
+		fmt.Println("Warning: branding assets are not part of the Kubernetes bundle. Add them to the pangolin pod and the branding section to privateConfig.yml yourself.")
+	}
+
+	values, err := buildKubernetesValues(config)
+	if err != nil {
+		return err
+	}
+
+	// The chart is always rendered once so both modes are validated
+	manifests, err := renderKubernetesManifests(values, config.KubernetesNamespace)
+	if err != nil {
+		return err
+	}
+	if err := validateKubernetesManifests(manifests); err != nil {
+		return fmt.Errorf("the rendered manifests are invalid: %v", err)
+	}
+
+	if output == outputKubernetes {
+		if err := os.MkdirAll("kubernetes", 0755); err != nil {
+			return fmt.Errorf("failed to create kubernetes directory: %v", err)
+		}
+		// The manifests contain the server secret
+		if err := os.WriteFile("kubernetes/pangolin.yaml", manifests, 0600); err != nil {
+			return fmt.Errorf("failed to write kubernetes/pangolin.yaml: %v", err)
+		}
+
+		fmt.Println("\nKubernetes manifests written to kubernetes/pangolin.yaml")
+		fmt.Println("Apply them with:")
+		fmt.Println("  kubectl apply -f kubernetes/pangolin.yaml")
+		return nil
+	}
+
+	chartDir := filepath.Join("helm", "pangolin")
+	err = fs.WalkDir(kubernetesFiles, "kubernetes", func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+
+		target := filepath.Join(chartDir, strings.TrimPrefix(path, "kubernetes"))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		content, err := kubernetesFiles.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		return os.WriteFile(target, content, 0644)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write the Helm chart: %v", err)
+	}
+
+	raw, err := yaml.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("failed to marshal values: %v", err)
+	}
+	header := "# Generated by the Pangolin installer. Contains the server secret, keep it private.\n"
+	if err := os.WriteFile(filepath.Join(chartDir, "values.yaml"), append([]byte(header), raw...), 0600); err != nil {
+		return fmt.Errorf("failed to write values.yaml: %v", err)
+	}
+
+	fmt.Printf("\nHelm chart written to %s\n", chartDir)
+	fmt.Println("Install it with:")
+	fmt.Printf("  helm install pangolin %s --namespace %s --create-namespace\n", chartDir, config.KubernetesNamespace)
+	return nil
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// imageLockPath records the digest the image of every compose service resolved
+// to when it was installed. It lives next to docker-compose.yml, which keeps
+// the tags so the images can be upgraded by changing them.
+const imageLockPath = "images.lock"
+
+// imageLock maps compose services to the image they were installed with.
+type imageLock struct {
+	Images map[string]lockedImage `yaml:"images"`
+}
+
+type lockedImage struct {
+	// Image is the reference from the template, e.g. docker.io/traefik:v3.6.
+	Image string `yaml:"image"`
+	// Digest is the manifest digest the reference resolved to.
+	Digest string `yaml:"digest"`
+}
+
+// composeService is the part of a compose service the lock needs.
+type composeService struct {
+	Image         string `yaml:"image"`
+	ContainerName string `yaml:"container_name"`
+}
+
+func readComposeServices(composePath string) (map[string]composeService, error) {
+	content, err := os.ReadFile(composePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading compose file: %w", err)
+	}
+
+	var compose struct {
+		Services map[string]composeService `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(content, &compose); err != nil {
+		return nil, fmt.Errorf("error parsing compose file: %w", err)
+	}
+	return compose.Services, nil
+}
+
+func readImageLock() (*imageLock, error) {
+	content, err := os.ReadFile(imageLockPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var lock imageLock
+	if err := yaml.Unmarshal(content, &lock); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", imageLockPath, err)
+	}
+	return &lock, nil
+}
+
+func writeImageLock(lock *imageLock) error {
+	content, err := yaml.Marshal(lock)
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", imageLockPath, err)
+	}
+	if err := os.WriteFile(imageLockPath, content, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", imageLockPath, err)
+	}
+	return nil
+}
+
+// splitDigest splits repo:tag@sha256:... into the reference and the digest.
+func splitDigest(image string) (string, string) {
+	ref, digest, _ := strings.Cut(image, "@")
+	return ref, digest
+}
+
+// imageRepository strips the tag and digest of an image reference and
+// normalizes it the way the engines report it in RepoDigests.
+func imageRepository(image string) string {
+	ref, _ := splitDigest(image)
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	ref = normalizeRepository(ref)
+	return strings.Replace(ref, dockerHub+"/library/", dockerHub+"/", 1)
+}
+
+// repoDigest returns the digest image has in repository.
+func repoDigest(inspect *ImageInspect, image string) (string, bool) {
+	repository := imageRepository(image)
+	for _, repoDigest := range inspect.RepoDigests {
+		if imageRepository(repoDigest) == repository {
+			_, digest := splitDigest(repoDigest)
+			return digest, true
+		}
+	}
+	return "", false
+}
+
+// hasRepoDigest reports whether image has digest in repository. An image can
+// have several digests, e.g. when it was pulled by tag and by digest.
+func hasRepoDigest(inspect *ImageInspect, image, digest string) bool {
+	repository := imageRepository(image)
+	for _, repoDigest := range inspect.RepoDigests {
+		if imageRepository(repoDigest) == repository && strings.HasSuffix(repoDigest, "@"+digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// lockImages records the digest of the pulled image of every compose service
+// in the lock. Services whose image is already locked keep their digest unless
+// update is set. It must run after the images were pulled.
+func lockImages(containerType SupportedContainer, composePath string, update bool) error {
+	rt, err := containerRuntime(containerType)
+	if err != nil {
+		return err
+	}
+
+	services, err := readComposeServices(composePath)
+	if err != nil {
+		return err
+	}
+
+	lock, err := readImageLock()
+	if errors.Is(err, os.ErrNotExist) {
+		lock = &imageLock{}
+	} else if err != nil {
+		return err
+	}
+	if lock.Images == nil {
+		lock.Images = map[string]lockedImage{}
+	}
+
+	for name, service := range services {
+		if service.Image == "" {
+			continue
+		}
+		ref, pinned := splitDigest(service.Image)
+		locked, ok := lock.Images[name]
+		if pinned != "" && ok && pinned == locked.Digest {
+			// Earlier installers pinned the digest in the compose file, which
+			// kept the image from being upgraded
+			if err := setServiceImage(composePath, name, ref); err != nil {
+				return err
+			}
+		}
+		if !update && ok && locked.Image == ref {
+			continue
+		}
+
+		inspect, err := rt.InspectImage(ref)
+		if err != nil {
+			return err
+		}
+		digest, ok := repoDigest(inspect, ref)
+		if !ok {
+			// Images loaded from an archive or built locally have no digest
+			fmt.Printf("Warning: %s has no registry digest and is not locked\n", ref)
+			delete(lock.Images, name)
+			continue
+		}
+
+		lock.Images[name] = lockedImage{Image: ref, Digest: digest}
+	}
+
+	if err := writeImageLock(lock); err != nil {
+		return err
+	}
+	fmt.Printf("Recorded the image digests in %s\n", imageLockPath)
+	return nil
+}
+
+// unlockService drops a removed service from the lock.
+func unlockService(name string) error {
+	lock, err := readImageLock()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, ok := lock.Images[name]; !ok {
+		return nil
+	}
+	delete(lock.Images, name)
+	return writeImageLock(lock)
+}
+
+func setServiceImage(composePath, service, image string) error {
+	return updateYAMLFile(composePath, func(doc *yaml.Node) error {
+		current := lookupYAMLNode(doc, "services", service, "image")
+		if current != nil && current.Value == image {
+			return errYAMLUnchanged
+		}
+		return setYAMLValue(doc, image, "services", service, "image")
+	})
+}
+
+// verifyPulledImages warns when the image pulled for a locked service does not
+// have the locked digest, e.g. because the tag was moved to a new release.
+func verifyPulledImages(containerType SupportedContainer, composePath string) error {
+	lock, err := readImageLock()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	rt, err := containerRuntime(containerType)
+	if err != nil {
+		return err
+	}
+	services, err := readComposeServices(composePath)
+	if err != nil {
+		return err
+	}
+
+	for name, locked := range lock.Images {
+		service, ok := services[name]
+		if !ok {
+			continue
+		}
+		ref, _ := splitDigest(service.Image)
+		if ref != locked.Image {
+			// The service was changed, lockImages records the new image
+			continue
+		}
+
+		inspect, err := rt.InspectImage(service.Image)
+		if err != nil {
+			return err
+		}
+		if !hasRepoDigest(inspect, ref, locked.Digest) {
+			fmt.Printf("Warning: the pulled image of %s does not match the locked digest %s. Run verify --update once you trust the new image.\n", name, locked.Digest)
+		}
+	}
+	return nil
+}
+
+// imageDrift describes the difference between the lock and one service.
+func imageDrift(rt ContainerRuntime, name string, locked lockedImage, service composeService, found bool) string {
+	if !found {
+		return "not in docker-compose.yml"
+	}
+	ref, digest := splitDigest(service.Image)
+	if ref != locked.Image || (digest != "" && digest != locked.Digest) {
+		return fmt.Sprintf("docker-compose.yml uses %s", service.Image)
+	}
+
+	container := service.ContainerName
+	if container == "" {
+		container = name
+	}
+	inspect, err := rt.Inspect(container)
+	if errors.Is(err, errContainerNotFound) {
+		return "not running"
+	} else if err != nil {
+		return fmt.Sprintf("unknown (%v)", err)
+	}
+
+	image, err := rt.InspectImage(inspect.Image)
+	if err != nil {
+		return fmt.Sprintf("unknown (%v)", err)
+	}
+	if hasRepoDigest(image, locked.Image, locked.Digest) {
+		return ""
+	}
+	if digest, ok := repoDigest(image, locked.Image); ok {
+		return fmt.Sprintf("running %s", digest)
+	}
+	return fmt.Sprintf("running %s without a registry digest", inspect.Config.Image)
+}
+
+// runVerifyCommand reports drift between the image lock and the running
+// containers. With --update it first records the digests of the pulled
+// images, to accept an upgrade.
+func runVerifyCommand(args []string) error {
+	update := false
+	for _, arg := range args {
+		switch arg {
+		case "--update":
+			update = true
+		default:
+			return fmt.Errorf("usage: verify [--update]")
+		}
+	}
+
+	if _, err := enterInstallDirectory(); err != nil {
+		return err
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		return fmt.Errorf("could not detect the container runtime, pass --runtime")
+	}
+
+	if update {
+		if err := lockImages(containerType, "docker-compose.yml", true); err != nil {
+			return err
+		}
+	}
+
+	lock, err := readImageLock()
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s not found, the images of this installation are not locked", imageLockPath)
+	} else if err != nil {
+		return err
+	}
+	rt, err := containerRuntime(containerType)
+	if err != nil {
+		return err
+	}
+
+	services, err := readComposeServices("docker-compose.yml")
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range lock.Images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	drifted := 0
+	for _, name := range names {
+		locked := lock.Images[name]
+		service, found := services[name]
+		if drift := imageDrift(rt, name, locked, service, found); drift != "" {
+			drifted++
+			fmt.Printf("  %-12s drift: locked %s@%s, %s\n", name, locked.Image, locked.Digest, drift)
+			continue
+		}
+		fmt.Printf("  %-12s ok %s@%s\n", name, locked.Image, locked.Digest)
+	}
+
+	for name := range services {
+		if _, ok := lock.Images[name]; !ok {
+			drifted++
+			fmt.Printf("  %-12s not locked\n", name)
+		}
+	}
+
+	if drifted > 0 {
+		return fmt.Errorf("%d service(s) do not match %s", drifted, imageLockPath)
+	}
+	fmt.Println("All images match the lock.")
+	return nil
+}
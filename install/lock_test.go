@@ -0,0 +1,135 @@
+package main
+
+import "testing"
+
+const (
+	testDigest  = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	otherDigest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func TestSplitDigest(t *testing.T) {
+	tests := []struct {
+		image      string
+		wantRef    string
+		wantDigest string
+	}{
+		{
+			image:   "docker.io/fosrl/pangolin:1.0.0",
+			wantRef: "docker.io/fosrl/pangolin:1.0.0",
+		},
+		{
+			image:      "docker.io/fosrl/pangolin:1.0.0@" + testDigest,
+			wantRef:    "docker.io/fosrl/pangolin:1.0.0",
+			wantDigest: testDigest,
+		},
+		{
+			image:      "registry.example.com:5000/traefik@" + testDigest,
+			wantRef:    "registry.example.com:5000/traefik",
+			wantDigest: testDigest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			ref, digest := splitDigest(tt.image)
+			if ref != tt.wantRef || digest != tt.wantDigest {
+				t.Errorf("splitDigest() = %q, %q, want %q, %q", ref, digest, tt.wantRef, tt.wantDigest)
+			}
+		})
+	}
+}
+
+func TestRepoDigest(t *testing.T) {
+	tests := []struct {
+		name        string
+		repoDigests []string
+		image       string
+		want        string
+		wantOK      bool
+	}{
+		{
+			name:        "docker hub official image as docker reports it",
+			repoDigests: []string{"traefik@" + testDigest},
+			image:       "docker.io/traefik:v3.6",
+			want:        testDigest,
+			wantOK:      true,
+		},
+		{
+			name:        "docker hub official image as podman reports it",
+			repoDigests: []string{"docker.io/library/traefik@" + testDigest},
+			image:       "traefik:v3.6",
+			want:        testDigest,
+			wantOK:      true,
+		},
+		{
+			name:        "registry with a port",
+			repoDigests: []string{"registry.example.com:5000/fosrl/pangolin@" + testDigest},
+			image:       "registry.example.com:5000/fosrl/pangolin:1.0.0",
+			want:        testDigest,
+			wantOK:      true,
+		},
+		{
+			name:        "digest of the matching repository",
+			repoDigests: []string{"mirror.example.com/fosrl/gerbil@" + otherDigest, "fosrl/gerbil@" + testDigest},
+			image:       "docker.io/fosrl/gerbil:1.0.0",
+			want:        testDigest,
+			wantOK:      true,
+		},
+		{
+			name:        "other repository",
+			repoDigests: []string{"mirror.example.com/fosrl/gerbil@" + otherDigest},
+			image:       "docker.io/fosrl/gerbil:1.0.0",
+		},
+		{
+			name:  "loaded from an archive",
+			image: "docker.io/fosrl/gerbil:1.0.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := repoDigest(&ImageInspect{RepoDigests: tt.repoDigests}, tt.image)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("repoDigest() = %q, %t, want %q, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// TestImageDriftCompose covers the drift found in docker-compose.yml alone,
+// which is reported before the runtime is asked about the container.
+func TestImageDriftCompose(t *testing.T) {
+	locked := lockedImage{Image: "docker.io/fosrl/pangolin:1.0.0", Digest: testDigest}
+
+	tests := []struct {
+		name    string
+		service composeService
+		found   bool
+		want    string
+	}{
+		{
+			name: "service removed",
+			want: "not in docker-compose.yml",
+		},
+		{
+			name:    "tag changed",
+			service: composeService{Image: "docker.io/fosrl/pangolin:1.1.0"},
+			found:   true,
+			want:    "docker-compose.yml uses docker.io/fosrl/pangolin:1.1.0",
+		},
+		{
+			name:    "pinned to another digest",
+			service: composeService{Image: "docker.io/fosrl/pangolin:1.0.0@" + otherDigest},
+			found:   true,
+			want:    "docker-compose.yml uses docker.io/fosrl/pangolin:1.0.0@" + otherDigest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := imageDrift(nil, "pangolin", locked, tt.service, tt.found); got != tt.want {
+				t.Errorf("imageDrift() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"embed"
 	"encoding/base64"
+	"flag"
 	"fmt"
 	"io"
 	"io/fs"
@@ -36,37 +37,132 @@ func loadVersions(config *Config) {
 var configFiles embed.FS
 
 type Config struct {
-	InstallationContainerType SupportedContainer
-	PangolinVersion           string
-	GerbilVersion             string
-	BadgerVersion             string
-	BaseDomain                string
-	DashboardDomain           string
-	EnableIPv6                bool
-	LetsEncryptEmail          string
-	EnableEmail               bool
-	EmailSMTPHost             string
-	EmailSMTPPort             int
-	EmailSMTPUser             string
-	EmailSMTPPass             string
-	EmailNoReply              string
-	InstallGerbil             bool
-	TraefikBouncerKey         string
-	DoCrowdsecInstall         bool
-	EnableGeoblocking         bool
-	Secret                    string
-	IsEnterprise              bool
+	InstallationContainerType  SupportedContainer
+	PangolinVersion            string
+	GerbilVersion              string
+	BadgerVersion              string
+	BaseDomain                 string
+	Domains                    []DomainConfig
+	DashboardDomain            string
+	EnableIPv6                 bool
+	BehindProxy                bool
+	ProxyProtocol              bool
+	TrustedProxyIPs            []string
+	HTTPPort                   int
+	HTTPSPort                  int
+	TrustProxy                 int
+	ExternalTraefik            bool
+	ExternalTraefikNetwork     string
+	TraefikHTTPEntrypoint      string
+	TraefikHTTPSEntrypoint     string
+	TraefikCertResolver        string
+	LetsEncryptEmail           string
+	EnableEmail                bool
+	EmailSMTPHost              string
+	EmailSMTPPort              int
+	EmailSMTPUser              string
+	EmailSMTPPass              string
+	EmailNoReply               string
+	InstallGerbil              bool
+	TraefikBouncerKey          string
+	DoCrowdsecInstall          bool
+	InstallCrowdsec            bool
+	CrowdsecTrustLAN           bool
+	CaptchaProvider            string
+	CaptchaSiteKey             string
+	CaptchaSecretKey           string
+	CrowdsecEnrollKey          string
+	CrowdsecInstanceName       string
+	CrowdsecShareDecisions     bool
+	CrowdsecShareContext       bool
+	CrowdsecWebhookURL         string
+	CrowdsecSlackWebhookURL    string
+	CrowdsecNotificationEmail  string
+	CrowdsecAppsec             bool
+	CrowdsecAppsecFailClosed   bool
+	CrowdsecAppsecBodyLimit    int
+	CrowdsecSSHLog             string
+	CrowdsecPangolinLogs       bool
+	InstallFirewallBouncer     bool
+	FirewallBouncerKey         string
+	EnableGeoblocking          bool
+	Secret                     string
+	IsEnterprise               bool
+	EnableRedis                bool
+	InstallRedis               bool
+	RedisHost                  string
+	RedisPort                  int
+	RedisPassword              string
+	RedisDB                    int
+	RedisTLS                   bool
+	RedisTLSRejectUnauthorized bool
+	Branding                   *BrandingInput
+	PodmanQuadlet              bool
+	PodmanRootless             bool
+	PodmanUser                 string
+	KubernetesNamespace        string
+	KubernetesHostNetwork      bool
+	KubernetesStorageClass     string
 }
 
+const defaultInstallDir = "/opt/pangolin"
+
 type SupportedContainer string
 
 const (
-	Docker    SupportedContainer = "docker"
-	Podman    SupportedContainer = "podman"
-	Undefined SupportedContainer = "undefined"
+	Docker        SupportedContainer = "docker"
+	DockerContext SupportedContainer = "docker-context"
+	Podman        SupportedContainer = "podman"
+	Nerdctl       SupportedContainer = "nerdctl"
+	Undefined     SupportedContainer = "undefined"
 )
 
+// runtimeFlag selects the container runtime instead of asking for it.
+var runtimeFlag string
+
 func main() {
+	flag.StringVar(&runtimeFlag, "runtime", "", "container runtime to use: docker, podman or nerdctl")
+	flag.StringVar(&dockerContextName, "docker-context", "", "manage the containers through this docker context")
+	flag.StringVar(&outputFlag, "output", outputCompose, "what to install: compose, or a kubernetes or helm bundle")
+	flag.StringVar(&bundleFlag, "bundle", "", "install offline from a bundle created with `bundle create`")
+	flag.StringVar(&registryFlag, "registry", "", "pull the images from this registry instead of docker.io, e.g. registry.example.com/pangolin")
+	flag.Var(&imageOverrideFlags, "image", "pull a repository from somewhere else: repository=replacement (repeatable)")
+	flag.StringVar(&registryMirrorFlag, "registry-mirror", "", "configure a pull-through mirror for Docker Hub in the container engine")
+	flag.StringVar(&registryCredentials, "registry-credentials", "", "YAML file with the username and password for the registry")
+	flag.Usage = printInstallerUsage
+	flag.Parse()
+
+	if runtimeFlag != "" {
+		if _, err := parseContainerType(runtimeFlag); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := validateOutputFlag(outputFlag); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if flag.NArg() > 0 {
+		runInstallerCommand(flag.Args())
+		return
+	}
+
+	if bundleFlag != "" {
+		if outputFlag != outputCompose {
+			fmt.Println("Error: --bundle can only be used with the compose output")
+			os.Exit(1)
+		}
+		bundle, err := openBundle(bundleFlag)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		activeBundle = bundle
+		defer bundle.Close()
+		fmt.Printf("Installing offline from the bundle for Pangolin %s.\n", bundle.manifest.PangolinVersion)
+	}
 
 	// print a banner about prerequisites - opening port 80, 443, 51820, and 21820 on the VPS and firewall and pointing your domain to the VPS IP with a records. Docs are at http://localhost:3000/Getting%20Started/dns-networking
 
@@ -76,17 +172,6 @@ func main() {
 	fmt.Println("- Open TCP ports 80 and 443 and UDP ports 51820 and 21820 on your VPS and firewall.")
 	fmt.Println("\nLets get started!")
 
-	if os.Geteuid() == 0 { // WE NEED TO BE SUDO TO CHECK THIS
-		for _, p := range []int{80, 443} {
-			if err := checkPortsAvailable(p); err != nil {
-				fmt.Fprintln(os.Stderr, err)
-
-				fmt.Printf("Please close any services on ports 80/443 in order to run the installation smoothly. If you already have the Pangolin stack running, shut them down before proceeding.\n")
-				os.Exit(1)
-			}
-		}
-	}
-
 	var config Config
 	var alreadyInstalled = false
 
@@ -97,11 +182,38 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err := loadRegistrySettings(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if outputFlag != outputCompose {
+		config = collectUserInput()
+		collectKubernetesInput(&config)
+		loadVersions(&config)
+		config.Secret = generateRandomSecretKey()
+
+		fmt.Println("\n=== Generating Kubernetes Bundle ===")
+		if err := writeKubernetesBundle(config, outputFlag); err != nil {
+			fmt.Printf("Error creating the Kubernetes bundle: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("\nOnce Pangolin is running, find the setup token in its logs and visit:\nhttps://%s/auth/initial-setup\n", config.DashboardDomain)
+		return
+	}
+
 	// check if there is already a config file
 	if _, err := os.Stat("config/config.yml"); err != nil {
 		config = collectUserInput()
+		if !config.ExternalTraefik {
+			checkRequiredPorts(config.HTTPPort, config.HTTPSPort)
+		}
 
 		loadVersions(&config)
+		if activeBundle != nil {
+			activeBundle.applyVersions(&config)
+		}
 		config.DoCrowdsecInstall = false
 		config.Secret = generateRandomSecretKey()
 
@@ -117,8 +229,38 @@ func main() {
 			os.Exit(1)
 		}
 
+		if config.InstallCrowdsec {
+			if err := addCrowdsecConfig(&config, installDir); err != nil {
+				fmt.Printf("Error adding CrowdSec: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if err := saveRegistrySettings(); err != nil {
+			fmt.Printf("Error saving registry settings: %v\n", err)
+			os.Exit(1)
+		}
+
+		if activeBundle != nil && !config.ExternalTraefik {
+			if err := activeBundle.installLocalPlugins(); err != nil {
+				fmt.Printf("Error installing the Traefik plugins from the bundle: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if config.Branding != nil {
+			if err := applyBranding(config.Branding); err != nil {
+				fmt.Printf("Error applying branding: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
 		fmt.Println("\nConfiguration files created successfully!")
 
+		if config.ExternalTraefik {
+			printExternalTraefikInstructions(config)
+		}
+
 		// Download MaxMind database if requested
 		if config.EnableGeoblocking {
 			fmt.Println("\n=== Downloading MaxMind Database ===")
@@ -134,6 +276,24 @@ func main() {
 
 			config.InstallationContainerType = podmanOrDocker()
 
+			if config.InstallationContainerType == Podman {
+				if activeBundle != nil {
+					fmt.Println("Quadlet is not available for bundle installations, using podman-compose.")
+				} else if config.InstallCrowdsec {
+					fmt.Println("Quadlet is not available with CrowdSec, using podman-compose.")
+				} else {
+					collectQuadletInput(&config)
+				}
+				if !config.PodmanQuadlet {
+					requirePodmanCompose()
+				}
+			}
+
+			if activeBundle != nil && !isRuntimeInstalled(config.InstallationContainerType) {
+				fmt.Printf("Error: %s cannot be installed without network access. Install it before running the installer with --bundle.\n", config.InstallationContainerType)
+				os.Exit(1)
+			}
+
 			if !isDockerInstalled() && runtime.GOOS == "linux" && config.InstallationContainerType == Docker {
 				if readBool("Docker is not installed. Would you like to install it?", true) {
 					if err := installDocker(); err != nil {
@@ -165,18 +325,50 @@ func main() {
 				}
 			}
 
-			if err := pullContainers(config.InstallationContainerType); err != nil {
-				fmt.Println("Error: ", err)
-				return
+			if registry.Mirror != "" && activeBundle == nil {
+				if err := configureRegistryMirror(config.InstallationContainerType); err != nil {
+					fmt.Printf("Warning: %v\n", err)
+				}
 			}
 
-			if err := startContainers(config.InstallationContainerType); err != nil {
-				fmt.Println("Error: ", err)
-				return
+			if config.PodmanQuadlet {
+				if err := installQuadlet(config, installDir); err != nil {
+					fmt.Println("Error: ", err)
+					return
+				}
+			} else {
+				if err := pullContainers(config.InstallationContainerType); err != nil {
+					fmt.Println("Error: ", err)
+					return
+				}
+
+				if activeBundle == nil {
+					if err := lockImages(config.InstallationContainerType, "docker-compose.yml", false); err != nil {
+						fmt.Println("Error: ", err)
+						return
+					}
+				}
+
+				if err := startContainers(config.InstallationContainerType); err != nil {
+					fmt.Println("Error: ", err)
+					return
+				}
+
+				if config.InstallCrowdsec {
+					if err := finishCrowdsecInstall(config); err != nil {
+						fmt.Printf("Error installing CrowdSec: %v\n", err)
+						return
+					}
+					fmt.Println("CrowdSec installed successfully!")
+				}
+
+				offerPangolinService(config.InstallationContainerType, installDir)
 			}
 		}
 
 	} else {
+		checkRequiredPorts(readPublishedPorts("docker-compose.yml")...)
+
 		alreadyInstalled = true
 		fmt.Println("Looks like you already installed Pangolin!")
 
@@ -206,14 +398,18 @@ func main() {
 		}
 	}
 
-	if !checkIsCrowdsecInstalledInCompose() {
-		fmt.Println("\n=== CrowdSec Install ===")
-		// check if crowdsec is installed
-		if readBool("Would you like to install CrowdSec?", false) {
-			fmt.Println("This installer constitutes a minimal viable CrowdSec deployment. CrowdSec will add extra complexity to your Pangolin installation and may not work to the best of its abilities out of the box. Users are expected to implement configuration adjustments on their own to achieve the best security posture. Consult the CrowdSec documentation for detailed configuration instructions.")
-
-			// BUG: crowdsec installation will be skipped if the user chooses to install on the first installation.
-			if readBool("Are you willing to manage CrowdSec?", false) {
+	// Fresh installations choose CrowdSec in collectUserInput
+	if alreadyInstalled {
+		if isQuadletInstall() {
+			fmt.Println("\nSkipping CrowdSec: the CrowdSec integration is not available for Quadlet installations yet.")
+		} else if activeBundle != nil {
+			fmt.Println("\nSkipping CrowdSec: CrowdSec downloads its hub collections at startup, which a bundle installation cannot do.")
+		} else if !checkIsTraefikInCompose() {
+			fmt.Println("\nSkipping CrowdSec: the CrowdSec integration requires the Traefik instance bundled with Pangolin.")
+		} else if !checkIsCrowdsecInstalledInCompose() {
+			fmt.Println("\n=== CrowdSec Install ===")
+			// check if crowdsec is installed
+			if readCrowdsecChoice() {
 				if config.DashboardDomain == "" {
 					traefikConfig, err := ReadTraefikConfig("config/traefik/traefik_config.yml")
 					if err != nil {
@@ -233,8 +429,18 @@ func main() {
 					}
 
 					config.DashboardDomain = parsedURL.Hostname()
+					// CrowdSec email notifications reuse the SMTP settings
+					config.EnableEmail = appConfig.EmailSMTPHost != ""
+					config.EmailSMTPHost = appConfig.EmailSMTPHost
+					config.EmailSMTPPort = appConfig.EmailSMTPPort
+					config.EmailSMTPUser = appConfig.EmailSMTPUser
+					config.EmailSMTPPass = appConfig.EmailSMTPPass
+					config.EmailNoReply = appConfig.EmailNoReply
 					config.LetsEncryptEmail = traefikConfig.LetsEncryptEmail
 					config.BadgerVersion = traefikConfig.BadgerVersion
+					if activeBundle != nil {
+						activeBundle.applyVersions(&config)
+					}
 
 					// print the values and check if they are right
 					fmt.Println("Detected values:")
@@ -257,6 +463,19 @@ func main() {
 					config.InstallationContainerType = detectedType
 					fmt.Printf("Detected container type: %s\n", config.InstallationContainerType)
 				}
+				if config.InstallationContainerType == Podman {
+					requirePodmanCompose()
+				}
+
+				// Values entered again with collectUserInput include the
+				// CrowdSec settings when CrowdSec was chosen there
+				if !config.InstallCrowdsec {
+					collectCaptchaInput(&config)
+					collectCrowdsecConsoleInput(&config)
+					collectCrowdsecTuningInput(&config)
+					collectCrowdsecNotificationsInput(&config)
+					config.InstallFirewallBouncer = readFirewallBouncerChoice()
+				}
 
 				config.DoCrowdsecInstall = true
 				err := installCrowdsec(config, installDir)
@@ -267,6 +486,11 @@ func main() {
 
 				fmt.Println("CrowdSec installed successfully!")
 			}
+		} else if containerType := detectContainerType(); containerType != Undefined {
+			// Keep the CrowdSec trusted IPs in line with the current settings
+			if err := syncCrowdsecTrustedIPs(containerType); err != nil {
+				fmt.Printf("Warning: could not update the CrowdSec trusted IPs: %v\n", err)
+			}
 		}
 	}
 
@@ -276,8 +500,10 @@ func main() {
 
 		// Check if containers were started during this installation
 		containersStarted := false
-		if (isDockerInstalled() && config.InstallationContainerType == Docker) ||
-			(isPodmanInstalled() && config.InstallationContainerType == Podman) {
+		if config.PodmanQuadlet {
+			containersStarted = true
+			printQuadletSetupToken(config)
+		} else if isRuntimeInstalled(config.InstallationContainerType) {
 			// Try to fetch and display the token if containers are running
 			containersStarted = true
 			printSetupToken(config.InstallationContainerType, config.DashboardDomain)
@@ -301,8 +527,6 @@ func hasExistingInstall(dir string) bool {
 }
 
 func findOrSelectInstallDirectory() string {
-	const defaultInstallDir = "/opt/pangolin"
-
 	// Get current working directory
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -406,23 +630,34 @@ func changeDirectoryOwnership(dir string) {
 }
 
 func podmanOrDocker() SupportedContainer {
-	inputContainer := readString("Would you like to run Pangolin as Docker or Podman containers?", "docker")
+	chosenContainer := containerTypeFromFlags()
+	if chosenContainer == Undefined {
+		inputContainer := readString("Would you like to run Pangolin as Docker, Podman or nerdctl containers?", "docker")
 
-	chosenContainer := Docker
-	if strings.EqualFold(inputContainer, "docker") {
-		chosenContainer = Docker
-	} else if strings.EqualFold(inputContainer, "podman") {
-		chosenContainer = Podman
-	} else {
-		fmt.Printf("Unrecognized container type: %s. Valid options are 'docker' or 'podman'.\n", inputContainer)
-		os.Exit(1)
+		var err error
+		chosenContainer, err = parseContainerType(inputContainer)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	switch chosenContainer {
 	case Podman:
-		if !isPodmanInstalled() {
-			fmt.Println("Podman or podman-compose is not installed. Please install both manually. Automated installation will be available in a later release.")
-			os.Exit(1)
+		if !isContainerInstalled("podman") {
+			if os.Geteuid() != 0 || runtime.GOOS != "linux" {
+				fmt.Println("Podman is not installed. Please install Podman manually or run this installer as root.")
+				os.Exit(1)
+			}
+			if !readBool("Podman is not installed. Would you like to install it?", true) {
+				fmt.Println("Please install Podman manually before running the installer again.")
+				os.Exit(1)
+			}
+			if err := installPodman(); err != nil {
+				fmt.Printf("Error installing Podman: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println("Podman installed successfully!")
 		}
 
 		if err := exec.Command("bash", "-c", "cat /etc/sysctl.d/99-podman.conf 2>/dev/null | grep 'net.ipv4.ip_unprivileged_port_start=' || cat /etc/sysctl.conf 2>/dev/null | grep 'net.ipv4.ip_unprivileged_port_start='").Run(); err != nil {
@@ -465,6 +700,23 @@ func podmanOrDocker() SupportedContainer {
 			fmt.Println("The installer will not be able to run docker commands without running it as root.")
 			os.Exit(1)
 		}
+
+	case DockerContext:
+		if err := exec.Command("docker", "context", "inspect", dockerContextName).Run(); err != nil {
+			fmt.Printf("Docker context %s does not exist. Create it with `docker context create` first.\n", dockerContextName)
+			os.Exit(1)
+		}
+		fmt.Printf("Using docker context %s.\n", dockerContextName)
+
+	case Nerdctl:
+		if !isContainerInstalled("nerdctl") {
+			fmt.Println("nerdctl is not installed. Please install nerdctl (the full distribution includes containerd and CNI plugins) before running the installer again.")
+			os.Exit(1)
+		}
+		if !isRuntimeRunning(Nerdctl) {
+			fmt.Println("nerdctl cannot reach containerd. Make sure containerd is running.")
+			os.Exit(1)
+		}
 	default:
 		// This shouldn't happen unless there's a third container runtime.
 		os.Exit(1)
@@ -480,8 +732,14 @@ func collectUserInput() Config {
 	fmt.Println("\n=== Basic Configuration ===")
 
 	config.IsEnterprise = readBoolNoDefault("Do you want to install the Enterprise version of Pangolin? The EE is free for personal use or for businesses making less than 100k USD annually.")
+	if config.IsEnterprise {
+		collectRedisInput(&config)
+		if readBool("Do you want to configure custom branding (app name, colors, logos)?", false) {
+			config.Branding = collectBrandingInput(BrandingConfig{})
+		}
+	}
 
-	config.BaseDomain = readString("Enter your base domain (no subdomain e.g. example.com)", "")
+	collectDomainsInput(&config)
 
 	// Set default dashboard domain after base domain is collected
 	defaultDashboardDomain := ""
@@ -523,6 +781,33 @@ func collectUserInput() Config {
 	fmt.Println("\n=== Advanced Configuration ===")
 
 	config.EnableIPv6 = readBool("Is your server IPv6 capable?", true)
+	if outputFlag == outputCompose {
+		collectExternalTraefikInput(&config)
+		if !config.ExternalTraefik {
+			collectProxyInput(&config)
+		}
+	} else {
+		// The cluster decides how traffic reaches Traefik, the questions about
+		// the host and its proxies do not apply to a Kubernetes bundle
+		config.HTTPPort = 80
+		config.HTTPSPort = 443
+		config.TrustProxy = 1
+	}
+	// The CrowdSec integration needs the bundled Traefik and compose, and
+	// CrowdSec downloads its hub collections when it starts
+	if activeBundle != nil {
+		fmt.Println("\nSkipping CrowdSec: CrowdSec downloads its hub collections at startup, which a bundle installation cannot do.")
+	} else if !config.ExternalTraefik && outputFlag == outputCompose {
+		fmt.Println("\n=== CrowdSec ===")
+		config.InstallCrowdsec = readCrowdsecChoice()
+		if config.InstallCrowdsec {
+			collectCaptchaInput(&config)
+			collectCrowdsecConsoleInput(&config)
+			collectCrowdsecTuningInput(&config)
+			collectCrowdsecNotificationsInput(&config)
+			config.InstallFirewallBouncer = readFirewallBouncerChoice()
+		}
+	}
 	config.EnableGeoblocking = readBool("Do you want to download the MaxMind GeoLite2 database for geoblocking functionality?", true)
 
 	if config.DashboardDomain == "" {
@@ -530,6 +815,10 @@ func collectUserInput() Config {
 		os.Exit(1)
 	}
 
+	if activeBundle == nil && outputFlag == outputCompose {
+		dnsPreflight(config.DashboardDomain, config.Domains)
+	}
+
 	return config
 }
 
@@ -546,6 +835,16 @@ func createConfigFiles(config Config) error {
 	if err := os.MkdirAll("config/logs", 0755); err != nil {
 		return fmt.Errorf("failed to create logs directory: %v", err)
 	}
+	if config.InstallRedis {
+		if err := os.MkdirAll("config/redis", 0755); err != nil {
+			return fmt.Errorf("failed to create redis directory: %v", err)
+		}
+	}
+	if config.Branding != nil {
+		if err := os.MkdirAll("config/branding", 0755); err != nil {
+			return fmt.Errorf("failed to create branding directory: %v", err)
+		}
+	}
 
 	// Walk through all embedded files
 	err := fs.WalkDir(configFiles, "config", func(path string, d fs.DirEntry, walkErr error) (err error) {
@@ -571,6 +870,24 @@ func createConfigFiles(config Config) error {
 			return nil
 		}
 
+		// only render the Traefik configuration that matches the chosen setup
+		if config.ExternalTraefik && (path == "config/traefik" || strings.HasPrefix(path, "config/traefik/")) {
+			return nil
+		}
+		if !config.ExternalTraefik && strings.HasPrefix(path, "config/traefik-external") {
+			return nil
+		}
+
+		// optional CrowdSec features only render their files when chosen
+		if !crowdsecFileEnabled(config, path) {
+			return nil
+		}
+
+		// the private config is only read by the Enterprise build
+		if !config.IsEnterprise && path == "config/privateConfig.yml" {
+			return nil
+		}
+
 		if d.IsDir() {
 			// Create directory
 			if err := os.MkdirAll(path, 0755); err != nil {
@@ -586,7 +903,7 @@ func createConfigFiles(config Config) error {
 		}
 
 		// Parse template
-		tmpl, err := template.New(d.Name()).Parse(string(content))
+		tmpl, err := template.New(d.Name()).Funcs(imageFuncs).Parse(string(content))
 		if err != nil {
 			return fmt.Errorf("failed to parse template %s: %v", path, err)
 		}
@@ -659,7 +976,7 @@ func printSetupToken(containerType SupportedContainer, dashboardDomain string) {
 
 	// Wait for Pangolin to be healthy
 	if err := waitForContainer("pangolin", containerType); err != nil {
-		fmt.Println("Warning: Pangolin container did not become healthy in time.")
+		fmt.Printf("Warning: Pangolin container did not become healthy in time: %v\n", err)
 		return
 	}
 
@@ -667,18 +984,17 @@ func printSetupToken(containerType SupportedContainer, dashboardDomain string) {
 	time.Sleep(2 * time.Second)
 
 	// Fetch logs
-	var cmd *exec.Cmd
-	if containerType == Docker {
-		cmd = exec.Command("docker", "logs", "pangolin")
-	} else {
-		cmd = exec.Command("podman", "logs", "pangolin")
-	}
-	output, err := cmd.Output()
+	output, err := containerLogs(containerType, "pangolin", "all")
 	if err != nil {
 		fmt.Println("Warning: Could not fetch Pangolin logs to find setup token.")
 		return
 	}
 
+	printSetupTokenFromLogs(output, dashboardDomain)
+}
+
+// printSetupTokenFromLogs finds the setup token in the Pangolin logs and prints it.
+func printSetupTokenFromLogs(output []byte, dashboardDomain string) {
 	// Parse for setup token
 	lines := strings.Split(string(output), "\n")
 	for i, line := range lines {
@@ -711,22 +1027,16 @@ func showSetupTokenInstructions(containerType SupportedContainer, dashboardDomai
 	fmt.Println("To get your setup token, you need to:")
 	fmt.Println("")
 	fmt.Println("1. Start the containers")
-	switch containerType {
-	case Docker:
-		fmt.Println("   docker compose up -d")
-	case Podman:
-		fmt.Println("   podman-compose up -d")
+	if rt, err := containerRuntime(containerType); err == nil {
+		fmt.Printf("   %s up -d\n", rt.ComposeCLI())
 	}
 
 	fmt.Println("")
 	fmt.Println("2. Wait for the Pangolin container to start and generate the token")
 	fmt.Println("")
 	fmt.Println("3. Check the container logs for the setup token")
-	switch containerType {
-	case Docker:
-		fmt.Println("   docker logs pangolin | grep -A 2 -B 2 'SETUP TOKEN'")
-	case Podman:
-		fmt.Println("   podman logs pangolin | grep -A 2 -B 2 'SETUP TOKEN'")
+	if rt, err := containerRuntime(containerType); err == nil {
+		fmt.Printf("   %s logs pangolin | grep -A 2 -B 2 'SETUP TOKEN'\n", rt.CLI())
 	}
 
 	fmt.Println("")
@@ -776,11 +1086,14 @@ func checkPortsAvailable(port int) error {
 }
 
 func downloadMaxMindDatabase() error {
+	if activeBundle != nil {
+		return activeBundle.installGeoLite2()
+	}
+
 	fmt.Println("Downloading MaxMind GeoLite2 Country database...")
 
 	// Download the GeoLite2 Country database
-	if err := run("curl", "-L", "-o", "GeoLite2-Country.tar.gz",
-		"https://github.com/GitSquared/node-geolite2-redist/raw/refs/heads/master/redist/GeoLite2-Country.tar.gz"); err != nil {
+	if err := run("curl", "-L", "-o", "GeoLite2-Country.tar.gz", geoLite2URL); err != nil {
 		return fmt.Errorf("failed to download GeoLite2 database: %v", err)
 	}
 
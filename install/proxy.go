@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// collectProxyInput asks whether Pangolin runs behind an existing reverse
+// proxy or load balancer and which addresses Traefik should trust for
+// forwarded headers and the PROXY protocol.
+func collectProxyInput(config *Config) {
+	config.HTTPPort = 80
+	config.HTTPSPort = 443
+	config.TrustProxy = 1
+
+	config.BehindProxy = readBool("Is this server behind another reverse proxy or load balancer (e.g. HAProxy, a cloud load balancer or Cloudflare)?", false)
+	if !config.BehindProxy {
+		return
+	}
+
+	fmt.Println("Traefik will only trust forwarded headers from the proxy addresses you enter.")
+	for {
+		cidrs, err := parseCIDRList(readString("Enter the IP addresses or CIDR ranges of the upstream proxies (comma separated)", ""))
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		config.TrustedProxyIPs = cidrs
+		break
+	}
+
+	config.ProxyProtocol = readBool("Does the upstream proxy send the PROXY protocol header?", false)
+	config.HTTPPort = readPort("Enter the host port Traefik should listen on for HTTP", 80)
+	config.HTTPSPort = readPort("Enter the host port Traefik should listen on for HTTPS", 443)
+	config.TrustProxy = readInt("Enter the number of proxies in front of Pangolin, including Traefik", 2)
+
+	if config.HTTPPort == config.HTTPSPort {
+		fmt.Println("Error: HTTP and HTTPS ports must be different")
+		os.Exit(1)
+	}
+
+	if config.HTTPPort != 80 {
+		fmt.Printf("Let's Encrypt validates certificates on port 80. Make sure the upstream proxy forwards port 80 to port %d.\n", config.HTTPPort)
+	}
+}
+
+func readPort(prompt string, defaultValue int) int {
+	for {
+		port := readInt(prompt, defaultValue)
+		if port > 0 && port <= 65535 {
+			return port
+		}
+		fmt.Println("Error: port must be between 1 and 65535")
+	}
+}
+
+// parseCIDRList parses a comma separated list of IP addresses and CIDR ranges.
+// Bare addresses are turned into single host ranges.
+func parseCIDRList(input string) ([]string, error) {
+	var cidrs []string
+	for _, entry := range strings.Split(input, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if ip := net.ParseIP(entry); ip != nil {
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid IP address or CIDR range", entry)
+		}
+		cidrs = append(cidrs, network.String())
+	}
+
+	if len(cidrs) == 0 {
+		return nil, fmt.Errorf("at least one IP address or CIDR range is required")
+	}
+
+	return cidrs, nil
+}
+
+// readPublishedPorts returns the host ports the compose file publishes for
+// Traefik's HTTP and HTTPS entrypoints. Installs that use an existing Traefik
+// publish none.
+func readPublishedPorts(composePath string) []int {
+	var ports []int
+
+	content, err := os.ReadFile(composePath)
+	if err != nil {
+		return ports
+	}
+
+	var compose struct {
+		Services map[string]struct {
+			Ports []string `yaml:"ports"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(content, &compose); err != nil {
+		return ports
+	}
+
+	for _, name := range []string{"gerbil", "traefik"} {
+		for _, mapping := range compose.Services[name].Ports {
+			parts := strings.Split(mapping, ":")
+			if len(parts) < 2 {
+				continue
+			}
+			host, err := strconv.Atoi(parts[len(parts)-2])
+			if err != nil {
+				continue
+			}
+			if container := parts[len(parts)-1]; container == "80" || container == "443" {
+				ports = append(ports, host)
+			}
+		}
+	}
+
+	return ports
+}
+
+// checkRequiredPorts makes sure the ports Traefik will publish are free. It
+// only runs as root because binding low ports needs privileges.
+func checkRequiredPorts(ports ...int) {
+	if os.Geteuid() != 0 { // WE NEED TO BE SUDO TO CHECK THIS
+		return
+	}
+
+	for _, p := range ports {
+		if err := checkPortsAvailable(p); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+
+			fmt.Printf("Please close any services on port %d in order to run the installation smoothly. If you already have the Pangolin stack running, shut them down before proceeding.\n", p)
+			os.Exit(1)
+		}
+	}
+}
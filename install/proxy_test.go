@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCIDRList(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "single IPv4 address",
+			input: "203.0.113.7",
+			want:  []string{"203.0.113.7/32"},
+		},
+		{
+			name:  "single IPv6 address",
+			input: "2001:db8::1",
+			want:  []string{"2001:db8::1/128"},
+		},
+		{
+			name:  "ranges are normalized to their network",
+			input: "10.1.2.3/8, 2001:db8::1/32",
+			want:  []string{"10.0.0.0/8", "2001:db8::/32"},
+		},
+		{
+			name:  "whitespace and empty entries",
+			input: " 173.245.48.0/20 ,, 103.21.244.0/22 ,",
+			want:  []string{"173.245.48.0/20", "103.21.244.0/22"},
+		},
+		{
+			name:    "empty",
+			input:   " , ",
+			wantErr: true,
+		},
+		{
+			name:    "hostname",
+			input:   "proxy.example.com",
+			wantErr: true,
+		},
+		{
+			name:    "invalid prefix",
+			input:   "10.0.0.0/33",
+			wantErr: true,
+		},
+		{
+			name:    "one invalid entry",
+			input:   "10.0.0.0/8, nope",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCIDRList(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCIDRList(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCIDRList(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
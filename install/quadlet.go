@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+)
+
+//go:embed quadlet/*
+var quadletFiles embed.FS
+
+const (
+	rootfulQuadletDir = "/etc/containers/systemd"
+	// quadletDir holds a copy of the generated units inside the installation
+	// directory so they can be reviewed and reinstalled.
+	quadletDir = "quadlet"
+	// redisSecretName is the Podman secret the Redis unit reads its password from.
+	redisSecretName = "pangolin-redis-password"
+)
+
+// quadletData is passed to the Quadlet unit templates.
+type quadletData struct {
+	Config
+	InstallDir    string
+	Rootless      bool
+	WantedBy      string
+	NotifyHealthy bool
+}
+
+// collectQuadletInput asks whether Podman should run Pangolin through Quadlet
+// systemd units and, if so, whether the containers run rootless under a
+// dedicated user.
+func collectQuadletInput(config *Config) {
+	if os.Geteuid() != 0 {
+		fmt.Println("Run the installer as root to manage Pangolin with Quadlet systemd units. Falling back to podman-compose.")
+		return
+	}
+
+	config.PodmanQuadlet = readBool("Would you like to run Pangolin as Podman Quadlet systemd units instead of podman-compose?", true)
+	if !config.PodmanQuadlet {
+		return
+	}
+
+	major, minor, err := podmanVersion()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if major < 4 || (major == 4 && minor < 4) {
+		fmt.Printf("Podman %d.%d does not support Quadlet. Podman 4.4 or newer is required.\n", major, minor)
+		os.Exit(1)
+	}
+
+	config.PodmanRootless = readBool("Would you like to run the containers rootless under a dedicated user?", true)
+	if config.PodmanRootless {
+		config.PodmanUser = readString("Enter the user that should run the containers", "pangolin")
+	}
+}
+
+func podmanVersion() (int, int, error) {
+	output, err := exec.Command("podman", "version", "--format", "{{.Client.Version}}").Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to determine the Podman version: %v", err)
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(string(output)), ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("unexpected Podman version: %s", strings.TrimSpace(string(output)))
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected Podman version: %s", strings.TrimSpace(string(output)))
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected Podman version: %s", strings.TrimSpace(string(output)))
+	}
+
+	return major, minor, nil
+}
+
+// isQuadletInstall reports whether the current installation is managed by
+// Quadlet units rather than a compose file.
+func isQuadletInstall() bool {
+	if _, err := os.Stat("docker-compose.yml"); err == nil {
+		return false
+	}
+	info, err := os.Stat(quadletDir)
+	return err == nil && info.IsDir()
+}
+
+// quadletContainers returns the names of the containers that have a unit in
+// the quadlet directory of the installation.
+func quadletContainers() []string {
+	var names []string
+	units, _ := filepath.Glob(filepath.Join(quadletDir, "*.container"))
+	for _, unit := range units {
+		names = append(names, strings.TrimSuffix(filepath.Base(unit), ".container"))
+	}
+	return names
+}
+
+// quadletOwner returns the user that runs the containers of a rootless
+// Quadlet installation, or nil when the units are installed rootful. The
+// installer hands the installation directory to that user.
+func quadletOwner() (*user.User, error) {
+	if _, err := os.Stat(filepath.Join(rootfulQuadletDir, "pangolin.container")); err == nil {
+		return nil, nil
+	}
+
+	info, err := os.Stat(quadletDir)
+	if err != nil {
+		return nil, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Uid == 0 {
+		return nil, nil
+	}
+
+	owner, err := user.LookupId(strconv.Itoa(int(stat.Uid)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the owner of %s: %v", quadletDir, err)
+	}
+	return owner, nil
+}
+
+// quadletRuntime returns the runtime that sees the containers of the Quadlet
+// installation. The containers of a rootless installation are only visible to
+// their owner, through the socket of the owner or as the owner.
+func quadletRuntime(owner *user.User) (ContainerRuntime, error) {
+	if owner == nil {
+		return containerRuntime(Podman)
+	}
+
+	config := Config{PodmanRootless: true, PodmanUser: owner.Username}
+	return podmanRuntime{engineRuntime{
+		cli:     podmanCommand(config).Args,
+		address: "unix:///run/user/" + owner.Uid + "/podman/podman.sock",
+	}}, nil
+}
+
+// quadletServices returns the systemd services generated for the stack.
+func quadletServices(config Config) []string {
+	services := []string{"pangolin.service"}
+	if config.InstallRedis {
+		services = append(services, "redis.service")
+	}
+	if config.InstallGerbil {
+		services = append(services, "gerbil.service")
+	}
+	if !config.ExternalTraefik {
+		services = append(services, "traefik.service")
+	}
+	return services
+}
+
+// renderQuadletUnits renders the Quadlet units for config into the quadlet
+// directory of the installation and returns their paths.
+func renderQuadletUnits(config Config, installDir string) ([]string, error) {
+	data := quadletData{
+		Config:     config,
+		InstallDir: installDir,
+		Rootless:   config.PodmanRootless,
+		WantedBy:   "multi-user.target",
+	}
+	if config.PodmanRootless {
+		data.WantedBy = "default.target"
+	}
+	// Notify=healthy lets systemd wait for the healthcheck, it needs Podman 5
+	if major, _, err := podmanVersion(); err == nil && major >= 5 {
+		data.NotifyHealthy = true
+	}
+
+	if err := os.MkdirAll(quadletDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create quadlet directory: %v", err)
+	}
+
+	var units []string
+	err := fs.WalkDir(quadletFiles, "quadlet", func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		name := d.Name()
+		switch {
+		case strings.HasPrefix(name, "redis.") && !config.InstallRedis:
+			return nil
+		case name == "gerbil.container" && !config.InstallGerbil:
+			return nil
+		case name == "traefik.container" && config.ExternalTraefik:
+			return nil
+		}
+
+		content, err := quadletFiles.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+
+		tmpl, err := template.New(name).Funcs(imageFuncs).Parse(string(content))
+		if err != nil {
+			return fmt.Errorf("failed to parse template %s: %v", path, err)
+		}
+
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			return fmt.Errorf("failed to execute template %s: %v", path, err)
+		}
+
+		unitPath := filepath.Join(quadletDir, name)
+		if err := os.WriteFile(unitPath, out.Bytes(), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", unitPath, err)
+		}
+		units = append(units, unitPath)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return units, nil
+}
+
+// ensurePodmanUser creates the user that runs the rootless containers and
+// enables lingering so its units start at boot without a login session.
+func ensurePodmanUser(name string) (*user.User, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		fmt.Printf("Creating user %s...\n", name)
+		if err := run("useradd", "--create-home", "--shell", "/usr/sbin/nologin", name); err != nil {
+			return nil, fmt.Errorf("failed to create user %s: %v", name, err)
+		}
+		if u, err = user.Lookup(name); err != nil {
+			return nil, fmt.Errorf("failed to look up user %s: %v", name, err)
+		}
+	}
+
+	if err := run("loginctl", "enable-linger", name); err != nil {
+		return nil, fmt.Errorf("failed to enable lingering for %s: %v", name, err)
+	}
+
+	return u, nil
+}
+
+// ensureWireGuardModule loads the WireGuard kernel module on the host. Rootless
+// containers cannot be granted SYS_MODULE, so Gerbil cannot load it itself.
+func ensureWireGuardModule() error {
+	if err := os.WriteFile("/etc/modules-load.d/pangolin-wireguard.conf", []byte("wireguard\n"), 0644); err != nil {
+		return fmt.Errorf("failed to persist the wireguard module: %v", err)
+	}
+	if err := run("modprobe", "wireguard"); err != nil {
+		return fmt.Errorf("failed to load the wireguard module: %v", err)
+	}
+	return nil
+}
+
+// podmanCommand builds a podman command that runs as the owner of the
+// containers.
+func podmanCommand(config Config, args ...string) *exec.Cmd {
+	if !config.PodmanRootless {
+		return exec.Command("podman", args...)
+	}
+
+	runtimeDir := "/run/user/0"
+	if u, err := user.Lookup(config.PodmanUser); err == nil {
+		runtimeDir = "/run/user/" + u.Uid
+	}
+
+	return exec.Command("runuser", append([]string{"-u", config.PodmanUser, "--", "env", "XDG_RUNTIME_DIR=" + runtimeDir, "podman"}, args...)...)
+}
+
+// quadletSystemctl runs systemctl in the scope the units are installed in.
+func quadletSystemctl(config Config, args ...string) error {
+	if config.PodmanRootless {
+		return run("systemctl", append([]string{"--user", "-M", config.PodmanUser + "@"}, args...)...)
+	}
+	return run("systemctl", args...)
+}
+
+// installQuadlet generates the Quadlet units, installs them into the systemd
+// search path of the chosen scope and starts the stack.
+func installQuadlet(config Config, installDir string) error {
+	unitDir := rootfulQuadletDir
+	var owner *user.User
+
+	if config.PodmanRootless {
+		u, err := ensurePodmanUser(config.PodmanUser)
+		if err != nil {
+			return err
+		}
+		owner = u
+		unitDir = filepath.Join(u.HomeDir, ".config/containers/systemd")
+
+		if config.InstallGerbil {
+			if err := ensureWireGuardModule(); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Unlike compose, podman does not create missing bind mount sources
+	if !config.ExternalTraefik {
+		if err := os.MkdirAll("config/traefik/logs", 0755); err != nil {
+			return fmt.Errorf("failed to create traefik logs directory: %v", err)
+		}
+	}
+
+	units, err := renderQuadletUnits(config, installDir)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(unitDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", unitDir, err)
+	}
+
+	var images []string
+	for _, unit := range units {
+		dst := filepath.Join(unitDir, filepath.Base(unit))
+		if err := copyFile(unit, dst); err != nil {
+			return fmt.Errorf("failed to install %s: %v", dst, err)
+		}
+
+		content, err := os.ReadFile(unit)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", unit, err)
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if image, ok := strings.CutPrefix(line, "Image="); ok {
+				images = append(images, image)
+			}
+		}
+	}
+
+	if owner != nil {
+		// The containers write into the install directory and read their units
+		// from the home directory of the owner.
+		for _, dir := range []string{installDir, filepath.Join(owner.HomeDir, ".config")} {
+			if err := run("chown", "-R", owner.Uid+":"+owner.Gid, dir); err != nil {
+				return fmt.Errorf("failed to change ownership of %s: %v", dir, err)
+			}
+		}
+	}
+
+	if err := registryLogin(func(args ...string) *exec.Cmd { return podmanCommand(config, args...) }); err != nil {
+		return err
+	}
+
+	fmt.Println("Pulling the container images...")
+	for _, image := range images {
+		cmd := podmanCommand(config, "pull", image)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to pull %s: %v", image, err)
+		}
+	}
+
+	if config.InstallRedis {
+		if err := createRedisSecret(config); err != nil {
+			return err
+		}
+	}
+
+	if err := quadletSystemctl(config, "daemon-reload"); err != nil {
+		return fmt.Errorf("failed to reload systemd: %v", err)
+	}
+
+	fmt.Println("Starting containers...")
+	if err := quadletSystemctl(config, append([]string{"start"}, quadletServices(config)...)...); err != nil {
+		return fmt.Errorf("failed to start containers: %v", err)
+	}
+
+	// The stack is managed by the units from now on, a leftover compose file
+	// would only invite starting a second copy.
+	if err := os.Remove("docker-compose.yml"); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: could not remove docker-compose.yml: %v\n", err)
+	}
+
+	fmt.Printf("Installed Quadlet units to %s\n", unitDir)
+	return nil
+}
+
+// createRedisSecret stores the Redis password as a Podman secret, the unit
+// files are world readable and must not contain it.
+func createRedisSecret(config Config) error {
+	// Older Podman releases have no --replace, drop a secret left by an
+	// earlier installation first.
+	_ = podmanCommand(config, "secret", "rm", redisSecretName).Run()
+
+	cmd := podmanCommand(config, "secret", "create", redisSecretName, "-")
+	cmd.Stdin = strings.NewReader(config.RedisPassword)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create the Redis password secret: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// waitForQuadletContainer waits until the healthcheck of a container passes.
+func waitForQuadletContainer(config Config, containerName string) error {
+	maxAttempts := 90
+	retryInterval := time.Second * 2
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if err := podmanCommand(config, "healthcheck", "run", containerName).Run(); err == nil {
+			return nil
+		}
+		time.Sleep(retryInterval)
+	}
+
+	return fmt.Errorf("container %s did not become healthy within %v seconds", containerName, maxAttempts*int(retryInterval.Seconds()))
+}
+
+func printQuadletSetupToken(config Config) {
+	fmt.Println("Waiting for Pangolin to generate setup token...")
+
+	if err := waitForQuadletContainer(config, "pangolin"); err != nil {
+		fmt.Println("Warning: Pangolin container did not become healthy in time.")
+		return
+	}
+
+	// Give a moment for the setup token to be generated
+	time.Sleep(2 * time.Second)
+
+	output, err := podmanCommand(config, "logs", "pangolin").CombinedOutput()
+	if err != nil {
+		fmt.Println("Warning: Could not fetch Pangolin logs to find setup token.")
+		return
+	}
+
+	printSetupTokenFromLogs(output, config.DashboardDomain)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+// collectRedisInput asks Enterprise users whether Pangolin should use Redis for
+// rate limiting and caching, and either provisions a bundled Redis container or
+// records the connection details of an existing Redis server.
+func collectRedisInput(config *Config) {
+	fmt.Println("\n=== Redis Configuration ===")
+	fmt.Println("Redis enables shared rate limiting and caching across multiple Pangolin instances.")
+
+	config.EnableRedis = readBool("Do you want to enable Redis?", false)
+	if !config.EnableRedis {
+		return
+	}
+
+	config.InstallRedis = readBool("Do you want the installer to add a Redis container to the stack? Choose No to use an existing Redis server", true)
+
+	if config.InstallRedis {
+		config.RedisHost = "redis"
+		config.RedisPort = 6379
+		config.RedisPassword = generateRandomPassword()
+		return
+	}
+
+	config.RedisHost = readString("Enter the Redis host", "")
+	config.RedisPort = readInt("Enter the Redis port", 6379)
+	if readBool("Does the Redis server require a password?", true) {
+		config.RedisPassword = readPassword("Enter the Redis password")
+	}
+	config.RedisDB = readInt("Enter the Redis database number", 0)
+
+	config.RedisTLS = readBool("Connect to Redis over TLS?", false)
+	if config.RedisTLS {
+		config.RedisTLSRejectUnauthorized = readBool("Verify the Redis server certificate? Choose No for self-signed certificates", true)
+	}
+
+	if config.RedisPort <= 0 || config.RedisPort > 65535 {
+		fmt.Println("Error: Redis port must be between 1 and 65535")
+		os.Exit(1)
+	}
+	if config.RedisDB < 0 {
+		fmt.Println("Error: Redis database number must not be negative")
+		os.Exit(1)
+	}
+}
+
+// generateRandomPassword returns a hex encoded random password that is safe to
+// embed in YAML and shell commands without quoting issues.
+func generateRandomPassword() string {
+	password := make([]byte, 24)
+	if _, err := rand.Read(password); err != nil {
+		panic(fmt.Sprintf("Failed to generate random password: %v", err))
+	}
+	return hex.EncodeToString(password)
+}
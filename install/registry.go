@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	registrySettingsPath = "config/registry.yml"
+	dockerHub            = "docker.io"
+	dockerDaemonConfig   = "/etc/docker/daemon.json"
+	podmanMirrorConfig   = "/etc/containers/registries.conf.d/pangolin-mirror.conf"
+	containerdHostsDir   = "/etc/containerd/certs.d/docker.io"
+)
+
+// registrySettings controls where the images are pulled from. They are saved
+// next to the configuration so later runs, like adding CrowdSec, pull from the
+// same place. Credentials are never saved.
+type registrySettings struct {
+	// Registry replaces docker.io in every image, e.g. registry.example.com/pangolin.
+	Registry string `yaml:"registry,omitempty"`
+	// Mirror is a pull-through cache for Docker Hub configured in the engine.
+	Mirror string `yaml:"mirror,omitempty"`
+	// Images maps a repository to the repository to use instead, e.g.
+	// docker.io/traefik: registry.example.com/traefik. The tag is kept.
+	Images map[string]string `yaml:"images,omitempty"`
+}
+
+var (
+	registry            registrySettings
+	registryFlag        string
+	registryMirrorFlag  string
+	registryCredentials string
+	imageOverrideFlags  imageOverrides
+)
+
+// imageOverrides collects repeated --image repository=replacement flags.
+type imageOverrides map[string]string
+
+func (o *imageOverrides) String() string {
+	var pairs []string
+	for from, to := range *o {
+		pairs = append(pairs, from+"="+to)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (o *imageOverrides) Set(value string) error {
+	from, to, ok := strings.Cut(value, "=")
+	if !ok || from == "" || to == "" {
+		return fmt.Errorf("expected repository=replacement, got %q", value)
+	}
+	if *o == nil {
+		*o = imageOverrides{}
+	}
+	(*o)[normalizeRepository(from)] = to
+	return nil
+}
+
+// imageFuncs is added to the templates that reference container images.
+var imageFuncs = template.FuncMap{
+	"image": rewriteImageRepository,
+}
+
+// loadRegistrySettings combines the saved settings of an existing installation
+// with the command line flags, which take precedence.
+func loadRegistrySettings() error {
+	if content, err := os.ReadFile(registrySettingsPath); err == nil {
+		if err := yaml.Unmarshal(content, &registry); err != nil {
+			return fmt.Errorf("error parsing %s: %w", registrySettingsPath, err)
+		}
+	}
+
+	if registryFlag != "" {
+		registry.Registry = strings.TrimSuffix(registryFlag, "/")
+	}
+	if registryMirrorFlag != "" {
+		registry.Mirror = registryMirrorFlag
+	}
+	for from, to := range imageOverrideFlags {
+		if registry.Images == nil {
+			registry.Images = map[string]string{}
+		}
+		registry.Images[from] = to
+	}
+
+	normalized := map[string]string{}
+	for from, to := range registry.Images {
+		normalized[normalizeRepository(from)] = to
+	}
+	registry.Images = normalized
+	return nil
+}
+
+// saveRegistrySettings writes the settings into the installation directory.
+func saveRegistrySettings() error {
+	if registry.Registry == "" && registry.Mirror == "" && len(registry.Images) == 0 {
+		return nil
+	}
+
+	content, err := yaml.Marshal(registry)
+	if err != nil {
+		return fmt.Errorf("error encoding registry settings: %w", err)
+	}
+	if err := os.WriteFile(registrySettingsPath, content, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", registrySettingsPath, err)
+	}
+	return nil
+}
+
+// normalizeRepository prefixes repositories without a registry host with
+// docker.io, the way the engines resolve them.
+func normalizeRepository(repository string) string {
+	first, _, found := strings.Cut(repository, "/")
+	if !found || !(strings.ContainsAny(first, ".:") || first == "localhost") {
+		return dockerHub + "/" + repository
+	}
+	return repository
+}
+
+// rewriteImageRepository returns the repository to pull instead of
+// repository, which must not contain a tag.
+func rewriteImageRepository(repository string) string {
+	repository = normalizeRepository(repository)
+	if override, ok := registry.Images[repository]; ok {
+		return override
+	}
+	if rest, ok := strings.CutPrefix(repository, dockerHub+"/"); ok && registry.Registry != "" {
+		return registry.Registry + "/" + rest
+	}
+	return repository
+}
+
+// rewriteImageReference applies rewriteImageRepository to a full image
+// reference and keeps its tag or digest.
+func rewriteImageReference(image string) string {
+	repository, suffix := image, ""
+	if i := strings.Index(image, "@"); i >= 0 {
+		repository, suffix = image[:i], image[i:]
+	} else if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		repository, suffix = image[:i], image[i:]
+	}
+	return rewriteImageRepository(repository) + suffix
+}
+
+// registryHost returns the host images are pulled from, which is the host the
+// installer logs in to.
+func registryHost() string {
+	if registry.Registry == "" {
+		return dockerHub
+	}
+	host, _, _ := strings.Cut(registry.Registry, "/")
+	return host
+}
+
+// readRegistryCredentials returns the registry credentials from the file
+// passed with --registry-credentials or from PANGOLIN_REGISTRY_USERNAME and
+// PANGOLIN_REGISTRY_PASSWORD. The file contains username and password keys.
+func readRegistryCredentials() (string, string, error) {
+	if registryCredentials != "" {
+		content, err := os.ReadFile(registryCredentials)
+		if err != nil {
+			return "", "", fmt.Errorf("error reading registry credentials: %w", err)
+		}
+		var credentials struct {
+			Username string `yaml:"username"`
+			Password string `yaml:"password"`
+		}
+		if err := yaml.Unmarshal(content, &credentials); err != nil {
+			return "", "", fmt.Errorf("error parsing registry credentials: %w", err)
+		}
+		if credentials.Username == "" || credentials.Password == "" {
+			return "", "", fmt.Errorf("%s must contain a username and a password", registryCredentials)
+		}
+		return credentials.Username, credentials.Password, nil
+	}
+
+	return os.Getenv("PANGOLIN_REGISTRY_USERNAME"), os.Getenv("PANGOLIN_REGISTRY_PASSWORD"), nil
+}
+
+// registryLogin logs in to the registry when credentials are available.
+// command builds the engine command line to run.
+func registryLogin(command func(args ...string) *exec.Cmd) error {
+	username, password, err := readRegistryCredentials()
+	if err != nil {
+		return err
+	}
+	if username == "" || password == "" {
+		return nil
+	}
+
+	host := registryHost()
+	fmt.Printf("Logging in to %s as %s...\n", host, username)
+	cmd := command("login", host, "--username", username, "--password-stdin")
+	cmd.Stdin = strings.NewReader(password)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to log in to %s: %v", host, err)
+	}
+	return nil
+}
+
+// configureRegistryMirror sets up the Docker Hub pull-through mirror in the
+// configuration of the local engine.
+func configureRegistryMirror(containerType SupportedContainer) error {
+	if registry.Mirror == "" {
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("configuring the registry mirror requires root")
+	}
+
+	fmt.Printf("Configuring %s as the Docker Hub mirror...\n", registry.Mirror)
+	switch containerType {
+	case Docker:
+		return configureDockerMirror()
+	case Podman:
+		mirror := strings.TrimPrefix(strings.TrimPrefix(registry.Mirror, "https://"), "http://")
+		content := fmt.Sprintf("[[registry]]\nprefix = \"docker.io\"\nlocation = \"docker.io\"\n\n[[registry.mirror]]\nlocation = %q\n", mirror)
+		if err := os.MkdirAll(filepath.Dir(podmanMirrorConfig), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %v", filepath.Dir(podmanMirrorConfig), err)
+		}
+		if err := os.WriteFile(podmanMirrorConfig, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", podmanMirrorConfig, err)
+		}
+	case Nerdctl:
+		mirror := registry.Mirror
+		if !strings.Contains(mirror, "://") {
+			mirror = "https://" + mirror
+		}
+		content := fmt.Sprintf("server = \"https://registry-1.docker.io\"\n\n[host.%q]\n  capabilities = [\"pull\", \"resolve\"]\n", mirror)
+		if err := os.MkdirAll(containerdHostsDir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %v", containerdHostsDir, err)
+		}
+		hostsPath := filepath.Join(containerdHostsDir, "hosts.toml")
+		if err := os.WriteFile(hostsPath, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", hostsPath, err)
+		}
+	default:
+		return fmt.Errorf("the registry mirror has to be configured on the engine of %s", containerType)
+	}
+	return nil
+}
+
+// configureDockerMirror adds the mirror to registry-mirrors in daemon.json
+// and restarts Docker to apply it.
+func configureDockerMirror() error {
+	daemonConfig := map[string]any{}
+	if content, err := os.ReadFile(dockerDaemonConfig); err == nil {
+		if err := json.Unmarshal(content, &daemonConfig); err != nil {
+			return fmt.Errorf("error parsing %s: %w", dockerDaemonConfig, err)
+		}
+	}
+
+	mirror := registry.Mirror
+	if !strings.Contains(mirror, "://") {
+		mirror = "https://" + mirror
+	}
+
+	mirrors, _ := daemonConfig["registry-mirrors"].([]any)
+	for _, m := range mirrors {
+		if m == mirror {
+			return nil
+		}
+	}
+	daemonConfig["registry-mirrors"] = append(mirrors, mirror)
+
+	content, err := json.MarshalIndent(daemonConfig, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", dockerDaemonConfig, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dockerDaemonConfig), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", filepath.Dir(dockerDaemonConfig), err)
+	}
+	if err := os.WriteFile(dockerDaemonConfig, content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", dockerDaemonConfig, err)
+	}
+
+	if err := run("systemctl", "restart", "docker"); err != nil {
+		return fmt.Errorf("failed to restart Docker: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContainerRuntime manages the Pangolin stack and its containers on one
+// container engine.
+type ContainerRuntime interface {
+	// Type identifies the runtime.
+	Type() SupportedContainer
+	// CLI is the command line used to talk to the engine, for instructions
+	// printed to the user.
+	CLI() string
+	// ComposeCLI is the command line used to manage the compose project.
+	ComposeCLI() string
+	Pull() error
+	Up() error
+	Down() error
+	Restart(container string) error
+	Logs(container, tail string) ([]byte, error)
+	Exec(container string, cmd ...string) (*ExecResult, error)
+	Inspect(container string) (*ContainerInspect, error)
+	InspectImage(image string) (*ImageInspect, error)
+	// PullImage, SaveImage and LoadImage move single images in and out of
+	// the engine for air-gapped bundles.
+	PullImage(image string) error
+	SaveImage(image, path string) error
+	LoadImage(path string) error
+	// Login logs in to the configured registry when credentials are
+	// available.
+	Login() error
+	// Running reports whether the engine is reachable.
+	Running() bool
+	// HasContainers reports whether the engine runs at least one container.
+	HasContainers() bool
+}
+
+// dockerContextName is the docker context used by the DockerContext runtime.
+// It is set from the --docker-context flag or detected from the active
+// context.
+var dockerContextName string
+
+// containerRuntime returns the runtime implementation for containerType.
+func containerRuntime(containerType SupportedContainer) (ContainerRuntime, error) {
+	switch containerType {
+	case Docker:
+		return dockerRuntime{engineRuntime{cli: []string{"docker"}, address: engineSocketAddress(Docker)}}, nil
+	case DockerContext:
+		if dockerContextName == "" {
+			return nil, fmt.Errorf("no docker context selected, pass --docker-context")
+		}
+		return dockerContextRuntime{
+			dockerRuntime: dockerRuntime{engineRuntime{
+				cli:     []string{"docker", "--context", dockerContextName},
+				address: dockerContextHost(dockerContextName),
+				env:     []string{"DOCKER_CONTEXT=" + dockerContextName},
+			}},
+			context: dockerContextName,
+		}, nil
+	case Podman:
+		return podmanRuntime{engineRuntime{cli: []string{"podman"}, address: engineSocketAddress(Podman)}}, nil
+	case Nerdctl:
+		// nerdctl has no Docker compatible API, everything goes through the CLI
+		return nerdctlRuntime{engineRuntime{cli: []string{"nerdctl"}}}, nil
+	}
+	return nil, fmt.Errorf("unsupported container type: %s", containerType)
+}
+
+// parseContainerType maps a runtime name as entered by the user or passed to
+// --runtime to its SupportedContainer.
+func parseContainerType(name string) (SupportedContainer, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "docker":
+		if dockerContextName != "" {
+			return DockerContext, nil
+		}
+		return Docker, nil
+	case "docker-context":
+		return DockerContext, nil
+	case "podman":
+		return Podman, nil
+	case "nerdctl":
+		return Nerdctl, nil
+	}
+	return Undefined, fmt.Errorf("unrecognized container type: %s. Valid options are 'docker', 'podman' or 'nerdctl'", name)
+}
+
+// containerTypeFromFlags returns the runtime selected with --runtime or
+// --docker-context, or Undefined when neither was passed.
+func containerTypeFromFlags() SupportedContainer {
+	if runtimeFlag == "" {
+		if dockerContextName != "" {
+			return DockerContext
+		}
+		return Undefined
+	}
+
+	// main validated the flag already
+	containerType, _ := parseContainerType(runtimeFlag)
+	return containerType
+}
+
+// isRuntimeInstalled reports whether the CLI of containerType is installed.
+func isRuntimeInstalled(containerType SupportedContainer) bool {
+	rt, err := containerRuntime(containerType)
+	if err != nil {
+		return false
+	}
+	return isContainerInstalled(strings.Fields(rt.CLI())[0])
+}
+
+// isRuntimeRunning reports whether the engine behind containerType is reachable.
+func isRuntimeRunning(containerType SupportedContainer) bool {
+	rt, err := containerRuntime(containerType)
+	return err == nil && rt.Running()
+}
+
+// activeDockerContext returns the docker context the docker CLI uses when it
+// is not the default one.
+func activeDockerContext() string {
+	if name := os.Getenv("DOCKER_CONTEXT"); name != "" {
+		return name
+	}
+	if os.Getenv("DOCKER_HOST") != "" || !isDockerInstalled() {
+		return ""
+	}
+
+	output, err := exec.Command("docker", "context", "show").Output()
+	if err != nil {
+		return ""
+	}
+	if name := strings.TrimSpace(string(output)); name != "default" {
+		return name
+	}
+	return ""
+}
+
+// dockerContextHost returns the engine endpoint of a docker context. SSH
+// endpoints are not supported by the API client and fall back to the CLI.
+func dockerContextHost(name string) string {
+	output, err := exec.Command("docker", "context", "inspect", name, "--format", "{{.Endpoints.docker.Host}}").Output()
+	if err != nil {
+		return ""
+	}
+	host := strings.TrimSpace(string(output))
+	if strings.HasPrefix(host, "ssh://") {
+		return ""
+	}
+	return host
+}
+
+// engineRuntime implements the container operations shared by all runtimes.
+// It uses the engine API when address is reachable and the CLI otherwise.
+type engineRuntime struct {
+	cli     []string
+	address string
+	env     []string
+}
+
+func (r engineRuntime) CLI() string {
+	return strings.Join(r.cli, " ")
+}
+
+var (
+	engineClientsMu sync.Mutex
+	// engineClients holds the reachable engines by address, so each one is
+	// dialed and pinged once per run.
+	engineClients = map[string]*engineClient{}
+)
+
+func (r engineRuntime) client() (*engineClient, error) {
+	if r.address == "" {
+		return nil, fmt.Errorf("no engine API available for %s", r.CLI())
+	}
+
+	engineClientsMu.Lock()
+	defer engineClientsMu.Unlock()
+	if client, ok := engineClients[r.address]; ok {
+		return client, nil
+	}
+	client, err := dialEngine(r.address)
+	if err != nil {
+		return nil, err
+	}
+	engineClients[r.address] = client
+	return client, nil
+}
+
+func (r engineRuntime) command(args ...string) *exec.Cmd {
+	cmd := exec.Command(r.cli[0], append(r.cli[1:], args...)...)
+	if len(r.env) > 0 {
+		cmd.Env = append(os.Environ(), r.env...)
+	}
+	return cmd
+}
+
+// runAttached runs a command with its output connected to the terminal.
+func (r engineRuntime) runAttached(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	if len(r.env) > 0 {
+		cmd.Env = append(os.Environ(), r.env...)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (r engineRuntime) PullImage(image string) error {
+	return r.runAttached(r.cli[0], append(r.cli[1:], "pull", image)...)
+}
+
+func (r engineRuntime) SaveImage(image, path string) error {
+	return r.runAttached(r.cli[0], append(r.cli[1:], "save", "-o", path, image)...)
+}
+
+func (r engineRuntime) LoadImage(path string) error {
+	return r.runAttached(r.cli[0], append(r.cli[1:], "load", "-i", path)...)
+}
+
+func (r engineRuntime) Login() error {
+	return registryLogin(r.command)
+}
+
+func (r engineRuntime) Running() bool {
+	if client, err := r.client(); err == nil {
+		// The client is cached, make sure the engine still answers
+		ctx, cancel := context.WithTimeout(context.Background(), engineRequestTimeout)
+		defer cancel()
+		if client.Ping(ctx) == nil {
+			return true
+		}
+	}
+	return r.command("info").Run() == nil
+}
+
+func (r engineRuntime) HasContainers() bool {
+	if client, err := r.client(); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), engineRequestTimeout)
+		defer cancel()
+		ids, err := client.ListContainers(ctx, false)
+		return err == nil && len(ids) > 0
+	}
+
+	if !isContainerInstalled(r.cli[0]) {
+		return false
+	}
+	output, err := r.command("ps", "-q").Output()
+	return err == nil && len(strings.TrimSpace(string(output))) > 0
+}
+
+func (r engineRuntime) Inspect(name string) (*ContainerInspect, error) {
+	if client, err := r.client(); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), engineRequestTimeout)
+		defer cancel()
+		return client.InspectContainer(ctx, name)
+	}
+
+	var stderr bytes.Buffer
+	cmd := r.command("container", "inspect", name)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.ToLower(stderr.String()); strings.Contains(msg, "no such") || strings.Contains(msg, "not found") {
+			return nil, errContainerNotFound
+		}
+		return nil, fmt.Errorf("failed to inspect %s: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var inspects []ContainerInspect
+	if err := json.Unmarshal(output, &inspects); err != nil {
+		return nil, fmt.Errorf("failed to decode inspect output for %s: %v", name, err)
+	}
+	if len(inspects) == 0 {
+		return nil, errContainerNotFound
+	}
+	return &inspects[0], nil
+}
+
+func (r engineRuntime) InspectImage(name string) (*ImageInspect, error) {
+	if client, err := r.client(); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), engineRequestTimeout)
+		defer cancel()
+		return client.InspectImage(ctx, name)
+	}
+
+	var stderr bytes.Buffer
+	cmd := r.command("image", "inspect", name)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect image %s: %v: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var inspects []ImageInspect
+	if err := json.Unmarshal(output, &inspects); err != nil {
+		return nil, fmt.Errorf("failed to decode image inspect output for %s: %v", name, err)
+	}
+	if len(inspects) == 0 {
+		return nil, fmt.Errorf("image %s not found", name)
+	}
+	return &inspects[0], nil
+}
+
+func (r engineRuntime) Logs(name, tail string) ([]byte, error) {
+	var out bytes.Buffer
+
+	if client, err := r.client(); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), engineRequestTimeout)
+		defer cancel()
+		if err := client.StreamLogs(ctx, name, tail, false, &out, &out); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	}
+
+	cmd := r.command("logs", "--tail", tail, name)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to fetch logs of %s: %v", name, err)
+	}
+	return out.Bytes(), nil
+}
+
+func (r engineRuntime) Exec(name string, cmd ...string) (*ExecResult, error) {
+	if client, err := r.client(); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		return client.Exec(ctx, name, cmd...)
+	}
+
+	var stdout, stderr bytes.Buffer
+	c := r.command(append([]string{"exec", name}, cmd...)...)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+
+	result := &ExecResult{}
+	if err := c.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("failed to exec in %s: %v", name, err)
+		}
+		result.ExitCode = exitErr.ExitCode()
+	}
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	return result, nil
+}
+
+// dockerRuntime manages the stack with `docker compose` or the standalone
+// `docker-compose`.
+type dockerRuntime struct {
+	engineRuntime
+}
+
+func (r dockerRuntime) Type() SupportedContainer { return Docker }
+
+func (r dockerRuntime) ComposeCLI() string {
+	if newStyle, err := detectComposeStyle(); err == nil && !newStyle {
+		return "docker-compose"
+	}
+	return r.CLI() + " compose"
+}
+
+func (r dockerRuntime) compose(args ...string) error {
+	if !isDockerInstalled() {
+		return fmt.Errorf("docker is not installed")
+	}
+
+	useNewStyle, err := detectComposeStyle()
+	if err != nil {
+		return err
+	}
+
+	args = append([]string{"-f", "docker-compose.yml"}, args...)
+	if useNewStyle {
+		return r.runAttached("docker", append([]string{"compose"}, args...)...)
+	}
+	return r.runAttached("docker-compose", args...)
+}
+
+func (r dockerRuntime) Pull() error { return r.compose("pull", "--policy", "always") }
+func (r dockerRuntime) Up() error   { return r.compose("up", "-d", "--force-recreate") }
+func (r dockerRuntime) Down() error { return r.compose("down") }
+
+func (r dockerRuntime) Restart(container string) error {
+	return r.compose("restart", container)
+}
+
+// dockerContextRuntime is Docker driven through a named docker context, for
+// hosts managed remotely. The context is passed to compose through
+// DOCKER_CONTEXT.
+type dockerContextRuntime struct {
+	dockerRuntime
+	context string
+}
+
+func (r dockerContextRuntime) Type() SupportedContainer { return DockerContext }
+
+func (r dockerContextRuntime) ComposeCLI() string {
+	if newStyle, err := detectComposeStyle(); err == nil && !newStyle {
+		return "DOCKER_CONTEXT=" + r.context + " docker-compose"
+	}
+	return r.CLI() + " compose"
+}
+
+// podmanRuntime manages the stack with podman-compose.
+type podmanRuntime struct {
+	engineRuntime
+}
+
+func (r podmanRuntime) Type() SupportedContainer { return Podman }
+func (r podmanRuntime) ComposeCLI() string       { return "podman-compose" }
+
+func (r podmanRuntime) compose(args ...string) error {
+	return r.runAttached("podman-compose", append([]string{"-f", "docker-compose.yml"}, args...)...)
+}
+
+func (r podmanRuntime) Pull() error { return r.compose("pull") }
+func (r podmanRuntime) Up() error   { return r.compose("up", "-d", "--force-recreate") }
+func (r podmanRuntime) Down() error { return r.compose("down") }
+
+// Restart restarts the whole project, podman-compose does not reliably
+// restart single services.
+func (r podmanRuntime) Restart(container string) error {
+	return r.compose("restart")
+}
+
+// nerdctlRuntime manages the stack on plain containerd with `nerdctl compose`.
+type nerdctlRuntime struct {
+	engineRuntime
+}
+
+func (r nerdctlRuntime) Type() SupportedContainer { return Nerdctl }
+func (r nerdctlRuntime) ComposeCLI() string       { return "nerdctl compose" }
+
+func (r nerdctlRuntime) compose(args ...string) error {
+	return r.runAttached("nerdctl", append([]string{"compose", "-f", "docker-compose.yml"}, args...)...)
+}
+
+func (r nerdctlRuntime) Pull() error { return r.compose("pull") }
+func (r nerdctlRuntime) Up() error   { return r.compose("up", "-d", "--force-recreate") }
+func (r nerdctlRuntime) Down() error { return r.compose("down") }
+
+func (r nerdctlRuntime) Restart(container string) error {
+	return r.compose("restart", container)
+}
+
+// Running checks containerd through `nerdctl info`.
+func (r nerdctlRuntime) Running() bool {
+	return r.command("info").Run() == nil
+}
+
+// inspectContainer returns the state of a container.
+func inspectContainer(containerType SupportedContainer, name string) (*ContainerInspect, error) {
+	rt, err := containerRuntime(containerType)
+	if err != nil {
+		return nil, err
+	}
+	return rt.Inspect(name)
+}
+
+// containerLogs returns the last lines of a container's logs ("all" for
+// everything), with stdout and stderr interleaved.
+func containerLogs(containerType SupportedContainer, name, tail string) ([]byte, error) {
+	rt, err := containerRuntime(containerType)
+	if err != nil {
+		return nil, err
+	}
+	return rt.Logs(name, tail)
+}
+
+// execInContainer runs a command inside a container.
+func execInContainer(containerType SupportedContainer, name string, cmd ...string) (*ExecResult, error) {
+	rt, err := containerRuntime(containerType)
+	if err != nil {
+		return nil, err
+	}
+	return rt.Exec(name, cmd...)
+}
+
+// runtimeCLI returns the command line for containerType to show in
+// instructions, falling back to the type name.
+func runtimeCLI(containerType SupportedContainer) string {
+	if rt, err := containerRuntime(containerType); err == nil {
+		return rt.CLI()
+	}
+	return string(containerType)
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed systemd/*
+var systemdFiles embed.FS
+
+const (
+	pangolinServiceName = "pangolin.service"
+	pangolinServicePath = "/etc/systemd/system/pangolin.service"
+)
+
+// pangolinServiceData is passed to the pangolin.service template.
+type pangolinServiceData struct {
+	Runtime     SupportedContainer
+	InstallDir  string
+	Compose     string
+	Requires    []string
+	Wants       []string
+	Environment []string
+}
+
+// hasSystemd reports whether the host is booted with systemd.
+func hasSystemd() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	_, err := os.Stat("/run/systemd/system")
+	return err == nil
+}
+
+// renderPangolinService renders a unit that brings the compose stack in
+// installDir up and down with the compose command of containerType.
+func renderPangolinService(containerType SupportedContainer, installDir string) ([]byte, error) {
+	data := pangolinServiceData{Runtime: containerType, InstallDir: installDir}
+
+	var command []string
+	switch containerType {
+	case Docker, DockerContext:
+		useNewStyle, err := detectComposeStyle()
+		if err != nil {
+			return nil, err
+		}
+		command = []string{"docker-compose"}
+		if useNewStyle {
+			command = []string{"docker", "compose"}
+		}
+		if containerType == Docker {
+			data.Requires = []string{"docker.service"}
+		} else {
+			// The engine runs elsewhere, only the context has to be selected
+			data.Environment = []string{"DOCKER_CONTEXT=" + dockerContextName}
+		}
+	case Podman:
+		command = []string{"podman-compose"}
+		// podman-compose does not need the API service, it is only ordered after it
+		data.Wants = []string{"podman.service", "podman.socket"}
+	case Nerdctl:
+		command = []string{"nerdctl", "compose"}
+		data.Requires = []string{"containerd.service"}
+	default:
+		return nil, fmt.Errorf("unsupported container type: %s", containerType)
+	}
+
+	// systemd needs absolute paths to the executables
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s is not installed: %v", command[0], err)
+	}
+	command[0] = path
+	data.Compose = strings.Join(command, " ")
+
+	content, err := systemdFiles.ReadFile("systemd/pangolin.service")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the service template: %v", err)
+	}
+	tmpl, err := template.New(pangolinServiceName).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the service template: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, fmt.Errorf("failed to execute the service template: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+// installPangolinService writes and enables pangolin.service. Starting it only
+// runs `compose up -d`, which leaves already running containers alone.
+func installPangolinService(containerType SupportedContainer, installDir string) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("installing %s requires root", pangolinServiceName)
+	}
+	if !hasSystemd() {
+		return fmt.Errorf("this system is not running systemd")
+	}
+
+	unit, err := renderPangolinService(containerType, installDir)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(pangolinServicePath, unit, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", pangolinServicePath, err)
+	}
+
+	if err := run("systemctl", "daemon-reload"); err != nil {
+		return fmt.Errorf("failed to reload systemd: %v", err)
+	}
+	if err := run("systemctl", "enable", "--now", pangolinServiceName); err != nil {
+		return fmt.Errorf("failed to enable %s: %v", pangolinServiceName, err)
+	}
+
+	fmt.Printf("Installed and enabled %s. Use `systemctl start|stop|status pangolin` to manage the stack.\n", pangolinServiceName)
+	return nil
+}
+
+// uninstallPangolinService disables and removes pangolin.service. The
+// containers keep running and fall back to their restart policies.
+func uninstallPangolinService() error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("removing %s requires root", pangolinServiceName)
+	}
+	if _, err := os.Stat(pangolinServicePath); os.IsNotExist(err) {
+		fmt.Printf("%s is not installed.\n", pangolinServiceName)
+		return nil
+	}
+
+	if err := run("systemctl", "disable", pangolinServiceName); err != nil {
+		return fmt.Errorf("failed to disable %s: %v", pangolinServiceName, err)
+	}
+	if err := os.Remove(pangolinServicePath); err != nil {
+		return fmt.Errorf("failed to remove %s: %v", pangolinServicePath, err)
+	}
+	if err := run("systemctl", "daemon-reload"); err != nil {
+		return fmt.Errorf("failed to reload systemd: %v", err)
+	}
+
+	fmt.Printf("Removed %s. The containers keep running.\n", pangolinServiceName)
+	return nil
+}
+
+// pangolinServiceStatus describes the state of pangolin.service.
+func pangolinServiceStatus() string {
+	if _, err := os.Stat(pangolinServicePath); err != nil {
+		return "not installed"
+	}
+	if !hasSystemd() {
+		return "installed, systemd is not running"
+	}
+
+	// is-active and is-enabled exit non-zero for inactive and disabled units
+	active, _ := exec.Command("systemctl", "is-active", pangolinServiceName).Output()
+	enabled, _ := exec.Command("systemctl", "is-enabled", pangolinServiceName).Output()
+	return fmt.Sprintf("%s, %s", strings.TrimSpace(string(active)), strings.TrimSpace(string(enabled)))
+}
+
+// offerPangolinService asks whether the stack should be managed by
+// pangolin.service after a compose based installation.
+func offerPangolinService(containerType SupportedContainer, installDir string) {
+	if os.Geteuid() != 0 || !hasSystemd() {
+		return
+	}
+
+	if !readBool("Would you like to install a pangolin.service systemd unit to start and stop Pangolin with the system?", true) {
+		return
+	}
+	if err := installPangolinService(containerType, installDir); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// readComposeContainers returns the container names of the services in the
+// compose file.
+func readComposeContainers(composePath string) ([]string, error) {
+	content, err := os.ReadFile(composePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading compose file: %w", err)
+	}
+
+	var compose struct {
+		Services map[string]struct {
+			ContainerName string `yaml:"container_name"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(content, &compose); err != nil {
+		return nil, fmt.Errorf("error parsing compose file: %w", err)
+	}
+
+	var names []string
+	for service, s := range compose.Services {
+		name := s.ContainerName
+		if name == "" {
+			name = service
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func runServiceCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: service install | service uninstall | service status")
+	}
+
+	installDir, err := enterInstallDirectory()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "install":
+		if isQuadletInstall() {
+			return fmt.Errorf("this installation is already managed by Quadlet systemd units")
+		}
+		containerType := detectContainerType()
+		if containerType == Undefined {
+			return fmt.Errorf("could not detect the container runtime, pass --runtime")
+		}
+		return installPangolinService(containerType, installDir)
+	case "uninstall":
+		return uninstallPangolinService()
+	case "status":
+		fmt.Printf("%s: %s\n", pangolinServiceName, pangolinServiceStatus())
+		return nil
+	}
+
+	return fmt.Errorf("unknown service command: %s", args[0])
+}
+
+// runStatusCommand prints the runtime, the state of every container of the
+// stack and the state of pangolin.service.
+func runStatusCommand(args []string) error {
+	installDir, err := enterInstallDirectory()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Installation: %s\n", installDir)
+
+	var rt ContainerRuntime
+	var containers []string
+	if isQuadletInstall() {
+		fmt.Println("Managed by: Quadlet systemd units")
+		owner, err := quadletOwner()
+		if err != nil {
+			return err
+		}
+		if owner != nil {
+			fmt.Printf("Rootless user: %s\n", owner.Username)
+		}
+		if rt, err = quadletRuntime(owner); err != nil {
+			return err
+		}
+		containers = quadletContainers()
+	} else {
+		if containers, err = readComposeContainers("docker-compose.yml"); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s\n", pangolinServiceName, pangolinServiceStatus())
+		if containerType := detectContainerType(); containerType != Undefined {
+			if rt, err = containerRuntime(containerType); err != nil {
+				return err
+			}
+		}
+	}
+
+	if rt == nil {
+		fmt.Println("Runtime: not detected")
+		return nil
+	}
+	fmt.Printf("Runtime: %s\n", rt.Type())
+
+	fmt.Println("Containers:")
+	for _, name := range containers {
+		inspect, err := rt.Inspect(name)
+		switch {
+		case errors.Is(err, errContainerNotFound):
+			fmt.Printf("  %-12s missing\n", name)
+		case err != nil:
+			fmt.Printf("  %-12s unknown (%v)\n", name, err)
+		case inspect.State.Health != nil && inspect.State.Health.Status != "":
+			fmt.Printf("  %-12s %s (%s)\n", name, inspect.State.Status, inspect.State.Health.Status)
+		default:
+			fmt.Printf("  %-12s %s\n", name, inspect.State.Status)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// minExternalTraefikMajor is the oldest Traefik major version the Badger
+// plugin supports.
+const minExternalTraefikMajor = 3
+
+var traefikVersionPattern = regexp.MustCompile(`(?m)^Version:\s*v?(\d+)\.(\d+)`)
+
+// collectExternalTraefikInput asks whether Pangolin should plug into a Traefik
+// instance that is already running on this host instead of shipping its own.
+func collectExternalTraefikInput(config *Config) {
+	config.ExternalTraefik = readBool("Do you already run Traefik on this host and want Pangolin to use it instead of installing its own?", false)
+	if !config.ExternalTraefik {
+		return
+	}
+
+	if config.InstallGerbil {
+		// Resources behind Newt tunnels are only routable over the WireGuard
+		// interface of Gerbil, whose network namespace the bundled Traefik shares
+		fmt.Println("An existing Traefik does not run in the network namespace of Gerbil, so it cannot reach resources behind Newt tunnels.")
+		fmt.Println("Only the dashboard and resources that the existing Traefik can reach directly will be proxied.")
+		if !readBool("Do you want to use the existing Traefik anyway?", false) {
+			config.ExternalTraefik = false
+			return
+		}
+	}
+
+	container := readString("Enter the name of the existing Traefik container", "traefik")
+	version, err := detectTraefikVersion(container)
+	if err != nil {
+		fmt.Printf("Warning: could not determine the Traefik version: %v\n", err)
+		fmt.Printf("Make sure Traefik is at least v%d.0, the Badger plugin does not support older versions.\n", minExternalTraefikMajor)
+	} else if err := validateTraefikVersion(version); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	} else {
+		fmt.Printf("Detected Traefik %s.\n", version)
+	}
+
+	config.ExternalTraefikNetwork = readString("Enter the docker network the existing Traefik is attached to", "traefik")
+	if cli := findContainerCLI(); cli != "" {
+		if err := exec.Command(cli, "network", "inspect", config.ExternalTraefikNetwork).Run(); err != nil {
+			fmt.Printf("Warning: network %s does not exist yet. Create it before starting Pangolin.\n", config.ExternalTraefikNetwork)
+		}
+	}
+
+	config.TraefikHTTPEntrypoint = readString("Enter the name of the HTTP entrypoint of the existing Traefik", "web")
+	config.TraefikHTTPSEntrypoint = readString("Enter the name of the HTTPS entrypoint of the existing Traefik", "websecure")
+	config.TraefikCertResolver = readString("Enter the name of the certificate resolver of the existing Traefik", "letsencrypt")
+}
+
+// findContainerCLI returns the first container engine CLI found on the PATH.
+func findContainerCLI() string {
+	for _, cli := range []string{string(Docker), string(Podman)} {
+		if _, err := exec.LookPath(cli); err == nil {
+			return cli
+		}
+	}
+	return ""
+}
+
+// detectTraefikVersion runs `traefik version` inside the given container.
+func detectTraefikVersion(container string) (string, error) {
+	cli := findContainerCLI()
+	if cli == "" {
+		return "", fmt.Errorf("neither docker nor podman is installed")
+	}
+
+	result, err := execInContainer(SupportedContainer(cli), container, "traefik", "version")
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("exit code %d", result.ExitCode)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to run traefik version in container %s: %v", container, err)
+	}
+
+	match := traefikVersionPattern.FindStringSubmatch(result.Stdout)
+	if match == nil {
+		return "", fmt.Errorf("unexpected output from traefik version: %s", strings.TrimSpace(result.Stdout))
+	}
+
+	return match[1] + "." + match[2], nil
+}
+
+func validateTraefikVersion(version string) error {
+	major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	if err != nil {
+		return fmt.Errorf("invalid Traefik version %q", version)
+	}
+	if major < minExternalTraefikMajor {
+		return fmt.Errorf("Traefik %s is too old for the Badger plugin, upgrade to v%d.0 or newer", version, minExternalTraefikMajor)
+	}
+	return nil
+}
+
+// printExternalTraefikInstructions explains how to merge the generated
+// fragments into the existing Traefik configuration.
+func printExternalTraefikInstructions(config Config) {
+	fmt.Println("\n=== Existing Traefik Integration ===")
+	fmt.Println("Pangolin does not ship its own Traefik. Merge the generated fragments into your Traefik configuration:")
+	fmt.Println("- config/traefik-external/static_config.yml:  the HTTP provider and the Badger plugin (static configuration, restart Traefik afterwards)")
+	fmt.Println("- config/traefik-external/dynamic_config.yml: the Badger middleware and the dashboard routers (dynamic configuration)")
+	fmt.Printf("Pangolin and Gerbil are attached to the external network %s so Traefik can reach their containers.\n", config.ExternalTraefikNetwork)
+	if config.InstallGerbil {
+		fmt.Println("Warning: Traefik is outside the network namespace of Gerbil and cannot reach resources behind Newt tunnels. Those resources will not be proxied.")
+	}
+}
+
+// checkIsTraefikInCompose reports whether the compose file ships the bundled
+// Traefik service.
+func checkIsTraefikInCompose() bool {
+	return checkIfTextInFile("docker-compose.yml", "traefik:") &&
+		checkIfTextInFile("docker-compose.yml", "--configFile=/etc/traefik/traefik_config.yml")
+}
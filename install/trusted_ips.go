@@ -0,0 +1,356 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// The subnet groups Pangolin uses when config.yml does not set them.
+	defaultGerbilSubnetGroup = "100.89.137.0/20"
+	defaultOrgsSubnetGroup   = "100.90.137.0/20"
+	// pangolinNetwork is the compose network the containers share.
+	pangolinNetwork = "pangolin"
+)
+
+// trustedContainers send requests through Traefik from inside the pangolin
+// network. Only their addresses are trusted, not the whole network: clients
+// that reach the published ports through docker-proxy appear with the address
+// of the network gateway.
+var trustedContainers = []string{"pangolin", "gerbil"}
+
+// staticSubnets are tried in order for the pangolin network when the trusted
+// containers get static addresses. The trusted containers use the first
+// addresses after the gateway, the engine hands out the upper half to the
+// other containers.
+var staticSubnets = []string{"172.29.0.0/24", "172.30.0.0/24", "172.31.0.0/24", "10.254.0.0/24"}
+
+// staticSubnetV6 is the unique local subnet used when the network has IPv6
+// enabled. The engine hands out addresses from ::1:0 on.
+const staticSubnetV6 = "fd70:616e:676f::/64"
+
+// lanClientIPs are the private ranges the CrowdSec middleware trusts when the
+// user chose to never block the LAN. They are kept by every sync.
+var lanClientIPs = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}
+
+// crowdsecTrustedIPs are the address lists of the CrowdSec Traefik plugin.
+type crowdsecTrustedIPs struct {
+	// ForwardedHeaders are the proxies whose X-Forwarded-For is believed.
+	ForwardedHeaders []string
+	// Clients are never blocked: tunnel subnets and the containers that
+	// talk to Traefik.
+	Clients []string
+}
+
+// readSubnetGroups returns the gerbil and orgs subnet groups of config.yml.
+func readSubnetGroups(configPath string) ([]string, error) {
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	var config struct {
+		Gerbil struct {
+			SubnetGroup string `yaml:"subnet_group"`
+		} `yaml:"gerbil"`
+		Orgs struct {
+			SubnetGroup string `yaml:"subnet_group"`
+		} `yaml:"orgs"`
+	}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("error parsing config file: %w", err)
+	}
+
+	groups := []string{defaultGerbilSubnetGroup, defaultOrgsSubnetGroup}
+	if config.Gerbil.SubnetGroup != "" {
+		groups[0] = config.Gerbil.SubnetGroup
+	}
+	if config.Orgs.SubnetGroup != "" {
+		groups[1] = config.Orgs.SubnetGroup
+	}
+	return groups, nil
+}
+
+// readUpstreamProxyIPs returns the upstream proxies Traefik trusts forwarded
+// headers from, as configured on the websecure entry point.
+func readUpstreamProxyIPs(traefikConfigPath string) ([]string, error) {
+	content, err := os.ReadFile(traefikConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading traefik config: %w", err)
+	}
+
+	var traefikConfig struct {
+		EntryPoints map[string]struct {
+			ForwardedHeaders struct {
+				TrustedIPs []string `yaml:"trustedIPs"`
+			} `yaml:"forwardedHeaders"`
+		} `yaml:"entryPoints"`
+	}
+	if err := yaml.Unmarshal(content, &traefikConfig); err != nil {
+		return nil, fmt.Errorf("error parsing traefik config: %w", err)
+	}
+	return traefikConfig.EntryPoints["websecure"].ForwardedHeaders.TrustedIPs, nil
+}
+
+// computeCrowdsecTrustedIPs derives the trusted addresses from config.yml, the
+// Traefik configuration and the addresses of the trusted containers.
+func computeCrowdsecTrustedIPs(containerType SupportedContainer) (*crowdsecTrustedIPs, error) {
+	groups, err := readSubnetGroups("config/config.yml")
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := readUpstreamProxyIPs("config/traefik/traefik_config.yml")
+	if err != nil {
+		return nil, err
+	}
+
+	trusted := &crowdsecTrustedIPs{ForwardedHeaders: proxies, Clients: groups}
+	if trusted.ForwardedHeaders == nil {
+		trusted.ForwardedHeaders = []string{}
+	}
+
+	static, err := readStaticAddresses("docker-compose.yml")
+	if err != nil {
+		return nil, err
+	}
+
+	rt, err := containerRuntime(containerType)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range trustedContainers {
+		if addresses, ok := static[name]; ok {
+			for _, address := range addresses {
+				if !slices.Contains(trusted.Clients, address) {
+					trusted.Clients = append(trusted.Clients, address)
+				}
+			}
+			continue
+		}
+
+		// Installations whose network was set up by hand keep dynamic
+		// addresses, which change when the container is recreated
+		inspect, err := rt.Inspect(name)
+		if errors.Is(err, errContainerNotFound) {
+			// Gerbil is optional
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Warning: could not read the address of the %s container: %v\n", name, err)
+			continue
+		}
+
+		var addresses []string
+		network := inspect.NetworkSettings.Networks[pangolinNetwork]
+		if network.IPAddress != "" {
+			addresses = append(addresses, network.IPAddress+"/32")
+		}
+		if network.GlobalIPv6Address != "" {
+			addresses = append(addresses, network.GlobalIPv6Address+"/128")
+		}
+		for _, address := range addresses {
+			if !slices.Contains(trusted.Clients, address) {
+				trusted.Clients = append(trusted.Clients, address)
+			}
+		}
+	}
+
+	return trusted, nil
+}
+
+// syncCrowdsecTrustedIPs writes the derived trusted addresses into the
+// CrowdSec middleware. Traefik watches the dynamic configuration, so the
+// change applies without a restart.
+func syncCrowdsecTrustedIPs(containerType SupportedContainer) error {
+	trusted, err := computeCrowdsecTrustedIPs(containerType)
+	if err != nil {
+		return err
+	}
+
+	const dynamicConfigPath = "config/traefik/dynamic_config.yml"
+	changed := false
+	err = updateYAMLFile(dynamicConfigPath, func(doc *yaml.Node) error {
+		plugin := lookupYAMLNode(doc, crowdsecPluginPath...)
+		if plugin == nil {
+			return fmt.Errorf("the CrowdSec middleware is missing from %s", dynamicConfigPath)
+		}
+
+		var current struct {
+			ForwardedHeaders []string `yaml:"forwardedHeadersTrustedIPs"`
+			Clients          []string `yaml:"clientTrustedIPs"`
+		}
+		if err := plugin.Decode(&current); err != nil {
+			return fmt.Errorf("error reading the CrowdSec middleware: %w", err)
+		}
+		for _, lan := range lanClientIPs {
+			if slices.Contains(current.Clients, lan) && !slices.Contains(trusted.Clients, lan) {
+				trusted.Clients = append(trusted.Clients, lan)
+			}
+		}
+		if slices.Equal(current.ForwardedHeaders, trusted.ForwardedHeaders) && slices.Equal(current.Clients, trusted.Clients) {
+			return errYAMLUnchanged
+		}
+
+		changed = true
+		if err := setYAMLValue(plugin, trusted.ForwardedHeaders, "forwardedHeadersTrustedIPs"); err != nil {
+			return err
+		}
+		return setYAMLValue(plugin, trusted.Clients, "clientTrustedIPs")
+	})
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		fmt.Println("Updated the trusted IPs of the CrowdSec middleware:")
+		fmt.Printf("  forwarded headers: %v\n", trusted.ForwardedHeaders)
+		fmt.Printf("  clients:           %v\n", trusted.Clients)
+	}
+	return nil
+}
+
+// chooseStaticSubnet returns the first of staticSubnets that does not overlap
+// a network of this host.
+func chooseStaticSubnet() (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", fmt.Errorf("error reading the host networks: %w", err)
+	}
+
+	for _, candidate := range staticSubnets {
+		subnet := netip.MustParsePrefix(candidate)
+		used := false
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			hostNet, err := netip.ParsePrefix(ipNet.String())
+			if err == nil && hostNet.Overlaps(subnet) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("all of %v are used by this host", staticSubnets)
+}
+
+// staticAddress returns the nth address of subnet.
+func staticAddress(subnet netip.Prefix, n int) string {
+	addr := subnet.Masked().Addr()
+	for range n {
+		addr = addr.Next()
+	}
+	return addr.String()
+}
+
+// assignStaticAddresses gives the pangolin network of the compose file a fixed
+// subnet and the trusted containers fixed addresses in it, so the addresses
+// the CrowdSec middleware trusts stay valid when the containers are
+// recreated. The network is only recreated with the new subnet after the
+// stack was taken down. A network configured by hand is left alone.
+func assignStaticAddresses(composePath, subnet string) error {
+	prefix, err := netip.ParsePrefix(subnet)
+	if err != nil {
+		return fmt.Errorf("invalid subnet %s: %w", subnet, err)
+	}
+	prefixV6 := netip.MustParsePrefix(staticSubnetV6)
+
+	return updateYAMLFile(composePath, func(doc *yaml.Node) error {
+		if lookupYAMLNode(doc, "networks", "default", "ipam") != nil {
+			if len(readStaticAddressesNode(doc)) == 0 {
+				fmt.Printf("Warning: the %s network has its own IPAM configuration, the addresses of %v are trusted as they are now.\n", pangolinNetwork, trustedContainers)
+			}
+			return errYAMLUnchanged
+		}
+
+		ipv6 := false
+		if enabled := lookupYAMLNode(doc, "networks", "default", "enable_ipv6"); enabled != nil && enabled.Value == "true" {
+			ipv6 = true
+		}
+
+		// The upper half of the subnet is left to the engine
+		ipRange := netip.PrefixFrom(netip.MustParseAddr(staticAddress(prefix, 1<<(prefix.Addr().BitLen()-prefix.Bits()-1))), prefix.Bits()+1)
+		type ipamConfig struct {
+			Subnet  string `yaml:"subnet"`
+			IPRange string `yaml:"ip_range"`
+		}
+		ipam := []ipamConfig{{Subnet: prefix.Masked().String(), IPRange: ipRange.String()}}
+		if ipv6 {
+			ipam = append(ipam, ipamConfig{Subnet: staticSubnetV6, IPRange: staticAddress(prefixV6, 1<<16) + "/112"})
+		}
+		if err := setYAMLValue(doc, map[string]any{"config": ipam}, "networks", "default", "ipam"); err != nil {
+			return err
+		}
+
+		for i, name := range trustedContainers {
+			if lookupYAMLNode(doc, "services", name) == nil {
+				continue
+			}
+			// A list of networks is turned into a mapping that can hold the address
+			if networks := lookupYAMLNode(doc, "services", name, "networks"); networks != nil && networks.Kind == yaml.SequenceNode {
+				mapping := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				for _, network := range networks.Content {
+					mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: network.Value}, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+				}
+				*networks = *mapping
+			}
+			network := lookupYAMLNode(doc, "services", name, "networks", "default")
+			if network == nil && lookupYAMLNode(doc, "services", name, "networks") != nil {
+				// Not on the pangolin network
+				continue
+			}
+			if network != nil && network.Kind != yaml.MappingNode {
+				*network = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			}
+
+			// .1 is the gateway
+			if err := setYAMLValue(doc, staticAddress(prefix, i+2), "services", name, "networks", "default", "ipv4_address"); err != nil {
+				return err
+			}
+			if ipv6 {
+				if err := setYAMLValue(doc, staticAddress(prefixV6, i+2), "services", name, "networks", "default", "ipv6_address"); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// readStaticAddresses returns the static addresses of the trusted containers
+// in the compose file as /32 and /128 ranges.
+func readStaticAddresses(composePath string) (map[string][]string, error) {
+	content, err := os.ReadFile(composePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading compose file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing compose file: %w", err)
+	}
+	return readStaticAddressesNode(&doc), nil
+}
+
+func readStaticAddressesNode(doc *yaml.Node) map[string][]string {
+	static := map[string][]string{}
+	for _, name := range trustedContainers {
+		if address := lookupYAMLNode(doc, "services", name, "networks", "default", "ipv4_address"); address != nil && address.Value != "" {
+			static[name] = append(static[name], address.Value+"/32")
+		}
+		if address := lookupYAMLNode(doc, "services", name, "networks", "default", "ipv6_address"); address != nil && address.Value != "" {
+			static[name] = append(static[name], address.Value+"/128")
+		}
+	}
+	return static
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAssignStaticAddresses(t *testing.T) {
+	tests := []struct {
+		name       string
+		compose    string
+		want       string
+		wantStatic map[string][]string
+	}{
+		{
+			name: "pangolin and gerbil",
+			compose: `services:
+  pangolin:
+    image: fosrl/pangolin
+  gerbil:
+    image: fosrl/gerbil
+  traefik:
+    network_mode: service:gerbil
+networks:
+  default:
+    driver: bridge
+    name: pangolin
+`,
+			want: `services:
+  pangolin:
+    image: fosrl/pangolin
+    networks:
+      default:
+        ipv4_address: 172.29.0.2
+  gerbil:
+    image: fosrl/gerbil
+    networks:
+      default:
+        ipv4_address: 172.29.0.3
+  traefik:
+    network_mode: service:gerbil
+networks:
+  default:
+    driver: bridge
+    name: pangolin
+    ipam:
+      config:
+        - subnet: 172.29.0.0/24
+          ip_range: 172.29.0.128/25
+`,
+			wantStatic: map[string][]string{"pangolin": {"172.29.0.2/32"}, "gerbil": {"172.29.0.3/32"}},
+		},
+		{
+			name: "ipv6 without gerbil",
+			compose: `services:
+  pangolin:
+    image: fosrl/pangolin
+networks:
+  default:
+    name: pangolin
+    enable_ipv6: true
+`,
+			want: `services:
+  pangolin:
+    image: fosrl/pangolin
+    networks:
+      default:
+        ipv4_address: 172.29.0.2
+        ipv6_address: fd70:616e:676f::2
+networks:
+  default:
+    name: pangolin
+    enable_ipv6: true
+    ipam:
+      config:
+        - subnet: 172.29.0.0/24
+          ip_range: 172.29.0.128/25
+        - subnet: fd70:616e:676f::/64
+          ip_range: fd70:616e:676f::1:0/112
+`,
+			wantStatic: map[string][]string{"pangolin": {"172.29.0.2/32", "fd70:616e:676f::2/128"}},
+		},
+		{
+			name: "list of networks",
+			compose: `services:
+  pangolin:
+    networks:
+      - default
+      - proxy
+networks:
+  default:
+    name: pangolin
+`,
+			want: `services:
+  pangolin:
+    networks:
+      default:
+        ipv4_address: 172.29.0.2
+      proxy: {}
+networks:
+  default:
+    name: pangolin
+    ipam:
+      config:
+        - subnet: 172.29.0.0/24
+          ip_range: 172.29.0.128/25
+`,
+			wantStatic: map[string][]string{"pangolin": {"172.29.0.2/32"}},
+		},
+		{
+			name: "network configured by hand",
+			compose: `services:
+  pangolin:
+    image: fosrl/pangolin
+networks:
+  default:
+    name: pangolin
+    ipam:
+      config:
+        - subnet: 192.168.50.0/24
+`,
+			want: `services:
+  pangolin:
+    image: fosrl/pangolin
+networks:
+  default:
+    name: pangolin
+    ipam:
+      config:
+        - subnet: 192.168.50.0/24
+`,
+			wantStatic: map[string][]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "docker-compose.yml")
+			if err := os.WriteFile(path, []byte(tt.compose), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := assignStaticAddresses(path, "172.29.0.0/24"); err != nil {
+				t.Fatalf("assignStaticAddresses() error = %v", err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decodeYAML(t, got), decodeYAML(t, []byte(tt.want))) {
+				t.Errorf("assignStaticAddresses() =\n%s\nwant\n%s", got, tt.want)
+			}
+
+			// A second run keeps the addresses
+			if err := assignStaticAddresses(path, "172.30.0.0/24"); err != nil {
+				t.Fatalf("assignStaticAddresses() error = %v", err)
+			}
+			static, err := readStaticAddresses(path)
+			if err != nil {
+				t.Fatalf("readStaticAddresses() error = %v", err)
+			}
+			if !reflect.DeepEqual(static, tt.wantStatic) {
+				t.Errorf("readStaticAddresses() = %v, want %v", static, tt.wantStatic)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultContainerWaitTimeout is how long the installer waits for a
+	// container to become ready. PANGOLIN_WAIT_TIMEOUT overrides it.
+	defaultContainerWaitTimeout = 3 * time.Minute
+	containerPollInterval       = 2 * time.Second
+	// containerDiagnosticLines is the number of log lines shown when a
+	// container does not become ready.
+	containerDiagnosticLines = "20"
+)
+
+// containerWaitTimeout returns the wait timeout, taken from the
+// PANGOLIN_WAIT_TIMEOUT environment variable (e.g. "5m") when set.
+func containerWaitTimeout() time.Duration {
+	value := os.Getenv("PANGOLIN_WAIT_TIMEOUT")
+	if value == "" {
+		return defaultContainerWaitTimeout
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		fmt.Printf("Warning: ignoring invalid PANGOLIN_WAIT_TIMEOUT %q, using %v\n", value, defaultContainerWaitTimeout)
+		return defaultContainerWaitTimeout
+	}
+	return timeout
+}
+
+// waitForContainer waits for a container with the default timeout.
+func waitForContainer(containerName string, containerType SupportedContainer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), containerWaitTimeout())
+	defer cancel()
+
+	return waitForContainerReady(ctx, containerType, containerName)
+}
+
+// waitForContainers waits for several containers concurrently and returns the
+// errors of all containers that did not become ready.
+func waitForContainers(ctx context.Context, containerType SupportedContainer, containerNames ...string) error {
+	errs := make([]error, len(containerNames))
+
+	var wg sync.WaitGroup
+	for i, name := range containerNames {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = waitForContainerReady(ctx, containerType, name)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// waitForContainerReady waits until a container is healthy or, if it has no
+// healthcheck, running. It gives up early when the container exits and
+// reports the last healthcheck results and log lines on failure.
+func waitForContainerReady(ctx context.Context, containerType SupportedContainer, containerName string) error {
+	ticker := time.NewTicker(containerPollInterval)
+	defer ticker.Stop()
+
+	var last *ContainerInspect
+	for {
+		inspect, err := inspectContainer(containerType, containerName)
+		if err == nil {
+			last = inspect
+			ready, err := containerReady(inspect)
+			if err != nil {
+				return containerWaitError(containerType, containerName, last, err)
+			}
+			if ready {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			reason := fmt.Errorf("not ready: %w", ctx.Err())
+			if last == nil {
+				reason = fmt.Errorf("container was not found: %w", ctx.Err())
+			} else if last.State.Health != nil {
+				reason = fmt.Errorf("health status is %s: %w", last.State.Health.Status, ctx.Err())
+			}
+			return containerWaitError(containerType, containerName, last, reason)
+		case <-ticker.C:
+		}
+	}
+}
+
+// containerReady reports whether a container is ready to serve. An error means
+// it will not become ready without intervention.
+func containerReady(inspect *ContainerInspect) (bool, error) {
+	switch inspect.State.Status {
+	case "exited", "dead":
+		return false, fmt.Errorf("container %s with exit code %d", inspect.State.Status, inspect.State.ExitCode)
+	}
+
+	if !inspect.State.Running {
+		return false, nil
+	}
+	if inspect.State.Health == nil || inspect.State.Health.Status == "" {
+		return true, nil
+	}
+	return inspect.State.Health.Status == "healthy", nil
+}
+
+// containerWaitError adds the last healthcheck outputs and the tail of the
+// container logs to err.
+func containerWaitError(containerType SupportedContainer, containerName string, inspect *ContainerInspect, err error) error {
+	var details strings.Builder
+
+	if inspect != nil && inspect.State.Health != nil && len(inspect.State.Health.Log) > 0 {
+		details.WriteString("\nLast healthcheck results:")
+		checks := inspect.State.Health.Log
+		if len(checks) > 3 {
+			checks = checks[len(checks)-3:]
+		}
+		for _, check := range checks {
+			fmt.Fprintf(&details, "\n  exit code %d: %s", check.ExitCode, strings.TrimSpace(check.Output))
+		}
+	}
+
+	if logs, logErr := containerLogs(containerType, containerName, containerDiagnosticLines); logErr == nil && len(logs) > 0 {
+		fmt.Fprintf(&details, "\nLast %s log lines:\n%s", containerDiagnosticLines, strings.TrimRight(string(logs), "\n"))
+	}
+
+	return fmt.Errorf("container %s is not ready: %w%s", containerName, err, details.String())
+}